@@ -2,6 +2,7 @@ package metrics
 
 import (
 	"strings"
+	"time"
 
 	"encoding/json"
 
@@ -18,10 +19,69 @@ type StickerizationCounters struct {
 	PrivateMessagesCounter prometheus.Counter
 	ImageCounter           prometheus.Counter
 	VideoCounter           prometheus.Counter
+	TextCounter            prometheus.Counter
+	StickerCounter         prometheus.Counter
+	GifCounter             prometheus.Counter
 	InvalidMediaCounter    prometheus.Counter
 	CountryCounter         *prometheus.CounterVec
 	ValidCounter           prometheus.Counter
 	InvalidCounter         prometheus.Counter
+	QualityHistogram       prometheus.Histogram
+	ThrottledCounter       *prometheus.CounterVec
+	AccessCounter          *prometheus.CounterVec
+	// pipeline stage latencies by media type
+	WebhookToQueueHistogram *prometheus.HistogramVec
+	QueueWaitHistogram      *prometheus.HistogramVec
+	DownloadHistogram       *prometheus.HistogramVec
+	ConversionHistogram     *prometheus.HistogramVec
+	UploadHistogram         *prometheus.HistogramVec
+	SendHistogram           *prometheus.HistogramVec
+	// sizes by media type
+	InputSizeHistogram        *prometheus.HistogramVec
+	OutputSizeHistogram       *prometheus.HistogramVec
+	CompressionRatioHistogram *prometheus.HistogramVec
+	OverLimitCounter          *prometheus.CounterVec
+}
+
+// latencyBuckets span 50ms to about 100s
+var latencyBuckets = prometheus.ExponentialBuckets(0.05, 2, 12)
+
+// sizeBuckets span 4KB to 8MB
+var sizeBuckets = prometheus.ExponentialBuckets(4096, 2, 12)
+
+// ratioBuckets span stickers a hundredth the size of their source to five times it
+var ratioBuckets = prometheus.ExponentialBuckets(0.01, 2, 10)
+
+// newSizeHistogram : a histogram of sizes by media type
+func newSizeHistogram(name string, help string, buckets []float64) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "Whatsticker",
+			Subsystem: "Size",
+			Name:      name,
+			Help:      help,
+			Buckets:   buckets,
+		},
+		[]string{
+			"media_type",
+		},
+	)
+}
+
+// newLatencyHistogram : seconds a pipeline stage took, by media type
+func newLatencyHistogram(name string, help string) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "Whatsticker",
+			Subsystem: "Latency",
+			Name:      name,
+			Help:      help,
+			Buckets:   latencyBuckets,
+		},
+		[]string{
+			"media_type",
+		},
+	)
 }
 
 type MetricConsumer struct {
@@ -54,6 +114,24 @@ func NewCounters() StickerizationCounters {
 		Name:      "Video",
 		Help:      "Stickerization Requests with Video as Media Type",
 	})
+	istextQueued := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "Whatsticker",
+		Subsystem: "MediaType",
+		Name:      "Text",
+		Help:      "Stickerization Requests with Text as Media Type",
+	})
+	isstickerQueued := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "Whatsticker",
+		Subsystem: "MediaType",
+		Name:      "Sticker",
+		Help:      "Sticker Extraction Requests with Sticker as Media Type",
+	})
+	isgifQueued := prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "Whatsticker",
+		Subsystem: "MediaType",
+		Name:      "Gif",
+		Help:      "Stickerization Requests with Gif as Media Type",
+	})
 	isnomediaQueued := prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace: "Whatsticker",
 		Subsystem: "MediaType",
@@ -83,15 +161,71 @@ func NewCounters() StickerizationCounters {
 			"country",
 		},
 	)
+	qualityObserved := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "Whatsticker",
+		Subsystem: "Encoding",
+		Name:      "StaticQuality",
+		Help:      "WebP Quality Static Stickers Were Encoded At To Fit 100KB",
+		Buckets:   prometheus.LinearBuckets(10, 10, 10),
+	})
+	throttledQueued := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "Whatsticker",
+			Subsystem: "Quota",
+			Name:      "Throttled",
+			Help:      "Stickerization Requests Refused For Going Over A Quota",
+		},
+		[]string{
+			"quota",
+		},
+	)
+	accessQueued := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "Whatsticker",
+			Subsystem: "Access",
+			Name:      "Decisions",
+			Help:      "Stickerization Requests Allowed Or Refused By Access Rules",
+		},
+		[]string{
+			"decision",
+		},
+	)
+	overLimitQueued := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "Whatsticker",
+			Subsystem: "Size",
+			Name:      "OverLimit",
+			Help:      "Stickers Over WhatsApp's Size Limit (100KB Static, 500KB Animated)",
+		},
+		[]string{
+			"media_type",
+		},
+	)
 	return StickerizationCounters{
-		GroupMessagesCounter:   isgroupQueued,
-		PrivateMessagesCounter: isprivateQueued,
-		ImageCounter:           isimageQueued,
-		VideoCounter:           isvideoQueued,
-		InvalidMediaCounter:    isnomediaQueued,
-		CountryCounter:         countryQueued,
-		ValidCounter:           isvalidQueued,
-		InvalidCounter:         isinvalidQueued,
+		GroupMessagesCounter:      isgroupQueued,
+		PrivateMessagesCounter:    isprivateQueued,
+		ImageCounter:              isimageQueued,
+		VideoCounter:              isvideoQueued,
+		TextCounter:               istextQueued,
+		StickerCounter:            isstickerQueued,
+		GifCounter:                isgifQueued,
+		InvalidMediaCounter:       isnomediaQueued,
+		CountryCounter:            countryQueued,
+		ValidCounter:              isvalidQueued,
+		InvalidCounter:            isinvalidQueued,
+		QualityHistogram:          qualityObserved,
+		ThrottledCounter:          throttledQueued,
+		AccessCounter:             accessQueued,
+		WebhookToQueueHistogram:   newLatencyHistogram("WebhookToQueueSeconds", "Seconds From Handling The Webhook To Queueing The Task"),
+		QueueWaitHistogram:        newLatencyHistogram("QueueWaitSeconds", "Seconds Tasks Waited In The Queue For A Worker"),
+		DownloadHistogram:         newLatencyHistogram("DownloadSeconds", "Seconds Spent Downloading Media"),
+		ConversionHistogram:       newLatencyHistogram("ConversionSeconds", "Seconds Spent Converting Media To A Sticker"),
+		UploadHistogram:           newLatencyHistogram("UploadSeconds", "Seconds Spent Uploading Stickers"),
+		SendHistogram:             newLatencyHistogram("SendSeconds", "Seconds Spent Sending Uploaded Stickers"),
+		InputSizeHistogram:        newSizeHistogram("InputBytes", "Bytes Of Media Sent To Be Stickerized", sizeBuckets),
+		OutputSizeHistogram:       newSizeHistogram("OutputBytes", "Bytes Of Stickers Produced", sizeBuckets),
+		CompressionRatioHistogram: newSizeHistogram("CompressionRatio", "Bytes Of Stickers Produced Per Byte Of Media", ratioBuckets),
+		OverLimitCounter:          overLimitQueued,
 	}
 }
 
@@ -106,9 +240,25 @@ func Initialize(registry *prometheus.Registry, counters StickerizationCounters)
 		counters.PrivateMessagesCounter,
 		counters.ImageCounter,
 		counters.VideoCounter,
+		counters.TextCounter,
+		counters.StickerCounter,
+		counters.GifCounter,
 		counters.InvalidMediaCounter,
 		counters.ValidCounter,
 		counters.InvalidCounter,
+		counters.QualityHistogram,
+		counters.ThrottledCounter,
+		counters.AccessCounter,
+		counters.WebhookToQueueHistogram,
+		counters.QueueWaitHistogram,
+		counters.DownloadHistogram,
+		counters.ConversionHistogram,
+		counters.UploadHistogram,
+		counters.SendHistogram,
+		counters.InputSizeHistogram,
+		counters.OutputSizeHistogram,
+		counters.CompressionRatioHistogram,
+		counters.OverLimitCounter,
 	)
 	return MetricConsumer{
 		Registry: registry,
@@ -118,6 +268,11 @@ func Initialize(registry *prometheus.Registry, counters StickerizationCounters)
 }
 
 func CheckAndIncrementMetrics(stickerMetric utils.StickerizationMetric, stickerCounters *StickerizationCounters) {
+	// access decisions are published apart from how the request went
+	if stickerMetric.Access != "" {
+		stickerCounters.AccessCounter.With(prometheus.Labels{"decision": stickerMetric.Access}).Inc()
+		return
+	}
 	senderCountry := extractCountry(stickerMetric.MessageSender)
 	if senderCountry != "" {
 		stickerCounters.CountryCounter.With(prometheus.Labels{"country": senderCountry}).Inc()
@@ -131,9 +286,23 @@ func CheckAndIncrementMetrics(stickerMetric utils.StickerizationMetric, stickerC
 		stickerCounters.ImageCounter.Inc()
 	} else if stickerMetric.MediaType == "video" {
 		stickerCounters.VideoCounter.Inc()
+	} else if stickerMetric.MediaType == "text" {
+		stickerCounters.TextCounter.Inc()
+	} else if stickerMetric.MediaType == "sticker" {
+		stickerCounters.StickerCounter.Inc()
+	} else if stickerMetric.MediaType == "gif" {
+		stickerCounters.GifCounter.Inc()
 	} else {
 		stickerCounters.InvalidMediaCounter.Inc()
 	}
+	if stickerMetric.Validated && (stickerMetric.MediaType == "image" || stickerMetric.MediaType == "text") {
+		stickerCounters.QualityHistogram.Observe(float64(stickerMetric.Quality))
+	}
+	if stickerMetric.Throttled != "" {
+		stickerCounters.ThrottledCounter.With(prometheus.Labels{"quota": stickerMetric.Throttled}).Inc()
+	}
+	observeLatencies(stickerMetric, stickerCounters)
+	observeSizes(stickerMetric, stickerCounters)
 	if stickerMetric.Validated {
 		stickerCounters.ValidCounter.Inc()
 	} else {
@@ -141,6 +310,58 @@ func CheckAndIncrementMetrics(stickerMetric utils.StickerizationMetric, stickerC
 	}
 }
 
+// observeStage records the seconds from start to end, skipping stages
+// the task never went through
+func observeStage(histogram *prometheus.HistogramVec, mediaType string, start time.Time, end time.Time) {
+	if start.IsZero() || end.IsZero() || end.Before(start) {
+		return
+	}
+	histogram.With(prometheus.Labels{"media_type": mediaType}).Observe(end.Sub(start).Seconds())
+}
+
+// observeLatencies records how long the task behind stickerMetric spent in each stage
+func observeLatencies(stickerMetric utils.StickerizationMetric, stickerCounters *StickerizationCounters) {
+	timings := stickerMetric.Timings
+	mediaType := stickerMetric.MediaType
+	observeStage(stickerCounters.WebhookToQueueHistogram, mediaType, timings.Received, timings.Queued)
+	observeStage(stickerCounters.QueueWaitHistogram, mediaType, timings.Queued, timings.ConvertStarted)
+	observeStage(stickerCounters.DownloadHistogram, mediaType, timings.DownloadStarted, timings.Downloaded)
+	observeStage(stickerCounters.ConversionHistogram, mediaType, timings.ConvertStarted, timings.Converted)
+	observeStage(stickerCounters.UploadHistogram, mediaType, timings.UploadStarted, timings.Uploaded)
+	observeStage(stickerCounters.SendHistogram, mediaType, timings.Uploaded, timings.Sent)
+}
+
+// sizeLimit is whatsapp's limit on stickers made from mediaType, 0 for
+// media that is not made into a sticker
+func sizeLimit(mediaType string) int {
+	switch mediaType {
+	case "image", "text":
+		return utils.MaxStaticBytes
+	case "video", "gif":
+		return utils.MaxAnimatedBytes
+	}
+	return 0
+}
+
+// observeSizes records the sizes of the media and sticker behind stickerMetric
+func observeSizes(stickerMetric utils.StickerizationMetric, stickerCounters *StickerizationCounters) {
+	labels := prometheus.Labels{"media_type": stickerMetric.MediaType}
+	initial, final := stickerMetric.InitialMediaLength, stickerMetric.FinalMediaLength
+	if initial > 0 {
+		stickerCounters.InputSizeHistogram.With(labels).Observe(float64(initial))
+	}
+	if final == 0 {
+		return
+	}
+	stickerCounters.OutputSizeHistogram.With(labels).Observe(float64(final))
+	if initial > 0 {
+		stickerCounters.CompressionRatioHistogram.With(labels).Observe(float64(final) / float64(initial))
+	}
+	if limit := sizeLimit(stickerMetric.MediaType); limit > 0 && final > limit {
+		stickerCounters.OverLimitCounter.With(labels).Inc()
+	}
+}
+
 func extractCountry(number string) string {
 	phoneNumber := strings.Trim(number, "+")
 	country := phonenumber.GetISO3166ByNumber(phoneNumber, true)
@@ -0,0 +1,368 @@
+// Package admin serves the API operators use to run the bot, on its
+// own port and behind a bearer token
+package admin
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deven96/whatsticker/master/handler"
+	"github.com/deven96/whatsticker/master/store"
+	"github.com/deven96/whatsticker/utils"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultTaskLimit is how many tasks /tasks lists unless asked for more
+const DefaultTaskLimit = 50
+
+// MaxTaskLimit is the most tasks /tasks and /stages look at
+const MaxTaskLimit = 1000
+
+// Server : the admin API
+type Server struct {
+	Token        string        // bearer token every request must carry
+	Channel      *amqp.Channel // kept apart from the channel messages are consumed on
+	Queues       []string      // names of the queues whose depths are reported
+	ConvertQueue *amqp.Queue
+	DeadLetters  *amqp.Queue
+	Store        store.Store
+
+	// serialises requests using the channel so gets and acks do not interleave
+	lock sync.Mutex
+}
+
+// Handler : routes of the admin API behind authentication
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/queues", s.queues)
+	mux.HandleFunc("/tasks", s.tasks)
+	mux.HandleFunc("/tasks/", s.task)
+	mux.HandleFunc("/stages", s.stages)
+	mux.HandleFunc("/deadletters/requeue", s.requeue)
+	mux.HandleFunc("/access", s.access)
+	mux.HandleFunc("/features", s.features)
+	return s.authenticate(mux)
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if s.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func methodNotAllowed(w http.ResponseWriter) {
+	writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+}
+
+// QueueDepth : messages waiting in a queue and how many consume it
+type QueueDepth struct {
+	Name      string `json:"name"`
+	Messages  int    `json:"messages"`
+	Consumers int    `json:"consumers"`
+}
+
+func (s *Server) queues(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	depths := []QueueDepth{}
+	for _, name := range s.Queues {
+		queue, err := s.Channel.QueueInspect(name)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		depths = append(depths, QueueDepth{Name: queue.Name, Messages: queue.Messages, Consumers: queue.Consumers})
+	}
+	writeJSON(w, http.StatusOK, depths)
+}
+
+// intParam reads a positive integer query parameter, returning fallback when absent or invalid
+func intParam(r *http.Request, name string, fallback int) int {
+	value, err := strconv.Atoi(r.URL.Query().Get(name))
+	if err != nil || value < 1 {
+		return fallback
+	}
+	return value
+}
+
+// taskLimit reads the limit query parameter, capped at MaxTaskLimit
+func taskLimit(r *http.Request) int {
+	limit := intParam(r, "limit", DefaultTaskLimit)
+	if limit > MaxTaskLimit {
+		return MaxTaskLimit
+	}
+	return limit
+}
+
+func (s *Server) tasks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	tasks, err := s.Store.RecentTasks(taskLimit(r))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if tasks == nil {
+		tasks = []store.Task{}
+	}
+	writeJSON(w, http.StatusOK, tasks)
+}
+
+// TaskDetail : a task with how it got to its state
+type TaskDetail struct {
+	store.Task
+	Transitions []store.Transition
+	Stages      []StageDuration
+}
+
+// StageDuration : time spent between two states
+type StageDuration struct {
+	Stage   string  `json:"stage"`
+	Seconds float64 `json:"seconds"`
+}
+
+func stageName(stage store.Stage) string {
+	return string(stage.From) + "_to_" + string(stage.To)
+}
+
+func (s *Server) task(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	messageID := strings.TrimPrefix(r.URL.Path, "/tasks/")
+	task, err := s.Store.GetTask(messageID)
+	if err == store.ErrNotFound {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	transitions, err := s.Store.TaskTransitions(messageID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	detail := TaskDetail{Task: *task, Transitions: transitions, Stages: []StageDuration{}}
+	for _, stage := range store.Stages(transitions) {
+		detail.Stages = append(detail.Stages, StageDuration{Stage: stageName(stage), Seconds: stage.Duration.Seconds()})
+	}
+	writeJSON(w, http.StatusOK, detail)
+}
+
+// StageLatency : how long tasks took over a stage
+type StageLatency struct {
+	Stage  string  `json:"stage"`
+	Count  int     `json:"count"`
+	Mean   float64 `json:"mean_seconds"`
+	Median float64 `json:"p50_seconds"`
+	P95    float64 `json:"p95_seconds"`
+}
+
+// percentile of sorted durations
+func percentile(sorted []float64, p float64) float64 {
+	return sorted[int(math.Ceil(p*float64(len(sorted))))-1]
+}
+
+// stages reports per stage latencies over the most recent tasks
+func (s *Server) stages(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w)
+		return
+	}
+	recent, err := s.Store.RecentTransitions(taskLimit(r))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	durations := map[string][]float64{}
+	for _, transitions := range recent {
+		for _, stage := range store.Stages(transitions) {
+			durations[stageName(stage)] = append(durations[stageName(stage)], stage.Duration.Seconds())
+		}
+	}
+	latencies := []StageLatency{}
+	for stage, seconds := range durations {
+		sort.Float64s(seconds)
+		sum := 0.0
+		for _, second := range seconds {
+			sum += second
+		}
+		latencies = append(latencies, StageLatency{
+			Stage:  stage,
+			Count:  len(seconds),
+			Mean:   sum / float64(len(seconds)),
+			Median: percentile(seconds, 0.5),
+			P95:    percentile(seconds, 0.95),
+		})
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i].Stage < latencies[j].Stage })
+	writeJSON(w, http.StatusOK, latencies)
+}
+
+// requeue moves up to count dead lettered tasks back onto the convert
+// queue, dropping those whose media is gone since they cannot be converted
+func (s *Server) requeue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w)
+		return
+	}
+	if s.DeadLetters == nil {
+		writeError(w, http.StatusNotFound, errors.New("no dead letter queue configured"))
+		return
+	}
+	count := intParam(r, "count", 1)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	requeued, dropped := []string{}, []string{}
+	for len(requeued) < count {
+		delivery, ok, err := s.Channel.Get(s.DeadLetters.Name, false)
+		if err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		if !ok {
+			break
+		}
+		var event utils.FailureEvent
+		if err = json.Unmarshal(delivery.Body, &event); err != nil {
+			log.Errorf("Dropping undecodable dead letter: %s", err)
+			delivery.Ack(false)
+			continue
+		}
+		if _, err = os.Stat(event.Task.MediaPath); err != nil {
+			log.Errorf("Dropping dead letter for %s: %s", event.Task.MessageID, err)
+			delivery.Ack(false)
+			dropped = append(dropped, event.Task.MessageID)
+			continue
+		}
+		// timings start again from the queue, the stages the task went
+		// through before it failed would otherwise be observed as days long
+		task := event.Task
+		task.Timings = utils.Timings{Queued: time.Now()}
+		taskBytes, _ := json.Marshal(&task)
+		utils.PublishBytesToQueue(s.Channel, s.ConvertQueue, taskBytes)
+		store.RecordTask(s.Store, task, utils.TaskQueued, "requeued")
+		delivery.Ack(false)
+		requeued = append(requeued, event.Task.MessageID)
+	}
+	writeJSON(w, http.StatusOK, map[string][]string{"requeued": requeued, "dropped": dropped})
+}
+
+func (s *Server) access(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		rules, err := s.Store.AccessRules()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if rules == nil {
+			rules = []store.AccessRule{}
+		}
+		writeJSON(w, http.StatusOK, rules)
+	case http.MethodPost, http.MethodPut:
+		var rule store.AccessRule
+		if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		rule.Pattern = handler.NormalizeNumber(rule.Pattern)
+		if rule.Pattern == "" {
+			writeError(w, http.StatusBadRequest, errors.New("pattern must contain digits"))
+			return
+		}
+		if rule.Action != store.AccessAllow && rule.Action != store.AccessBlock {
+			writeError(w, http.StatusBadRequest, errors.New("action must be allow or block"))
+			return
+		}
+		if err := s.Store.SaveAccessRule(&rule); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, rule)
+	case http.MethodDelete:
+		prefix, _ := strconv.ParseBool(r.URL.Query().Get("prefix"))
+		err := s.Store.DeleteAccessRule(handler.NormalizeNumber(r.URL.Query().Get("pattern")), prefix)
+		if err == store.ErrNotFound {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		methodNotAllowed(w)
+	}
+}
+
+// features lists feature flags, or with POST ?name=&enabled= toggles one
+func (s *Server) features(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodPut:
+		name := r.URL.Query().Get("name")
+		enabled, err := strconv.ParseBool(r.URL.Query().Get("enabled"))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("enabled must be true or false"))
+			return
+		}
+		known := false
+		for _, feature := range utils.KnownFeatures {
+			known = known || feature == name
+		}
+		if !known {
+			writeError(w, http.StatusNotFound, errors.New("unknown feature "+name))
+			return
+		}
+		log.Infof("Setting feature %s to %t", name, enabled)
+		if err = utils.SetFeature(name, enabled); err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+	default:
+		methodNotAllowed(w)
+		return
+	}
+	flags := map[string]bool{}
+	for _, feature := range utils.KnownFeatures {
+		flags[feature] = utils.FeatureEnabled(feature)
+	}
+	writeJSON(w, http.StatusOK, flags)
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"os"
+	"strings"
+
+	"github.com/deven96/whatsticker/master/store"
+	log "github.com/sirupsen/logrus"
+)
+
+// Access modes set by ACCESS_MODE
+const (
+	AccessOpen      = "open"      // everyone not blocked is served
+	AccessAllowlist = "allowlist" // only numbers with an allow rule are served
+)
+
+// Access decisions reported in metrics
+const (
+	DecisionAllowed    = "allowed"
+	DecisionBlocked    = "blocked"
+	DecisionNotAllowed = "not_allowlisted"
+)
+
+// accessMode is ACCESS_MODE, defaulting to AccessOpen
+func accessMode() string {
+	if strings.ToLower(os.Getenv("ACCESS_MODE")) == AccessAllowlist {
+		return AccessAllowlist
+	}
+	return AccessOpen
+}
+
+// NormalizeNumber strips a phone number down to its digits
+func NormalizeNumber(number string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, number)
+}
+
+// decideAccess returns whether phoneNumber may use the bot. Block rules
+// win over allow rules, and in AccessAllowlist mode a number needs an
+// allow rule to be served
+func decideAccess(phoneNumber string) string {
+	mode := accessMode()
+	// without rules fail closed for private deployments, open otherwise
+	unknown := DecisionAllowed
+	if mode == AccessAllowlist {
+		unknown = DecisionNotAllowed
+	}
+	if DB == nil {
+		return unknown
+	}
+	rules, err := DB.AccessRules()
+	if err != nil {
+		log.Errorf("Could not load access rules: %s", err)
+		return unknown
+	}
+	number := NormalizeNumber(phoneNumber)
+	allowed := false
+	for _, rule := range rules {
+		if !rule.Matches(number) {
+			continue
+		}
+		if rule.Action == store.AccessBlock {
+			return DecisionBlocked
+		}
+		allowed = allowed || rule.Action == store.AccessAllow
+	}
+	if mode == AccessAllowlist && !allowed {
+		return DecisionNotAllowed
+	}
+	return DecisionAllowed
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/deven96/whatsticker/master/store"
+)
+
+func TestDecideAccessWithoutStore(t *testing.T) {
+	DB = nil
+	if got := decideAccess("2348000000000"); got != DecisionAllowed {
+		t.Errorf("open mode decided %s", got)
+	}
+	t.Setenv("ACCESS_MODE", AccessAllowlist)
+	if got := decideAccess("2348000000000"); got != DecisionNotAllowed {
+		t.Errorf("allowlist mode without rules decided %s", got)
+	}
+}
+
+func TestDecideAccess(t *testing.T) {
+	useTestStore(t)
+	rules := []store.AccessRule{
+		{Pattern: "234", Prefix: true, Action: store.AccessAllow},
+		{Pattern: "2348000000001", Action: store.AccessBlock},
+	}
+	for i := range rules {
+		if err := DB.SaveAccessRule(&rules[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cases := []struct {
+		mode   string
+		number string
+		want   string
+	}{
+		{AccessOpen, "+234 800 000 0000", DecisionAllowed},
+		{AccessOpen, "2348000000001", DecisionBlocked},
+		{AccessOpen, "14150000000", DecisionAllowed},
+		{AccessAllowlist, "2348000000000", DecisionAllowed},
+		{AccessAllowlist, "2348000000001", DecisionBlocked},
+		{AccessAllowlist, "14150000000", DecisionNotAllowed},
+	}
+	for _, c := range cases {
+		t.Setenv("ACCESS_MODE", c.mode)
+		if got := decideAccess(c.number); got != c.want {
+			t.Errorf("%s mode decided %s for %s, want %s", c.mode, got, c.number, c.want)
+		}
+	}
+}
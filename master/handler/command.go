@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/deven96/whatsticker/master/whatsapp"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// CommandPrefix marks text messages meant as commands rather than text to stickerize
+const CommandPrefix = "/"
+
+const unknownCommandResponse = "Unknown command %s%s, send %shelp to see what I can do"
+
+// CommandContext is what a command gets to work with when it runs
+type CommandContext struct {
+	Message       *whatsapp.Message
+	PhoneNumberID string
+	Channel       *amqp.Channel
+	ConvertQueue  *amqp.Queue
+}
+
+// Reply : sends body as a reply to the command message
+func (ctx *CommandContext) Reply(body string) {
+	replyText(ctx.Message, ctx.PhoneNumberID, body)
+}
+
+// Command interface for chat commands such as /help
+type Command interface {
+	// Name the command is invoked by, without the prefix
+	Name() string
+	// Aliases : other names the command answers to
+	Aliases() []string
+	// Usage : the arguments the command takes e.g "[name]"
+	Usage() string
+	// Help : one line description shown by /help
+	Help() string
+	// Run : performs the command, replying through ctx
+	Run(ctx *CommandContext, args []string) error
+}
+
+var commands = map[string]Command{}
+
+// RegisterCommand : makes cmd available under its name and aliases
+func RegisterCommand(cmd Command) {
+	commands[cmd.Name()] = cmd
+	for _, alias := range cmd.Aliases() {
+		commands[alias] = cmd
+	}
+}
+
+// LookupCommand : finds a registered command by name or alias
+func LookupCommand(name string) (Command, bool) {
+	cmd, ok := commands[strings.ToLower(strings.TrimPrefix(name, CommandPrefix))]
+	return cmd, ok
+}
+
+// registeredCommands returns each command once, sorted by name
+func registeredCommands() []Command {
+	seen := map[string]bool{}
+	var unique []Command
+	for _, cmd := range commands {
+		if !seen[cmd.Name()] {
+			seen[cmd.Name()] = true
+			unique = append(unique, cmd)
+		}
+	}
+	sort.Slice(unique, func(i, j int) bool { return unique[i].Name() < unique[j].Name() })
+	return unique
+}
+
+// IsCommand : text messages starting with the CommandPrefix
+func IsCommand(body string) bool {
+	body = strings.TrimSpace(body)
+	return len(body) > len(CommandPrefix) && strings.HasPrefix(body, CommandPrefix)
+}
+
+// ParseCommand splits a command message into the command name and its
+// arguments, double quotes group words into one argument
+func ParseCommand(body string) (string, []string) {
+	tokens := splitCaption(strings.TrimPrefix(strings.TrimSpace(body), CommandPrefix))
+	if len(tokens) == 0 {
+		return "", nil
+	}
+	return strings.ToLower(tokens[0]), tokens[1:]
+}
+
+// Router runs the command in a text message
+type Router struct {
+	Message       *whatsapp.Message
+	PhoneNumberID string
+	Name          string
+	Args          []string
+	Command       Command
+}
+
+func (handler *Router) SetUp(message *whatsapp.Message, phoneNumberID string) {
+	handler.Message = message
+	handler.PhoneNumberID = phoneNumberID
+	handler.Name, handler.Args = ParseCommand(message.Text.Body)
+}
+
+func (handler *Router) Validate() error {
+	if handler == nil {
+		return errors.New("please initialize handler")
+	}
+	cmd, ok := LookupCommand(handler.Name)
+	if !ok {
+		replyText(handler.Message, handler.PhoneNumberID, fmt.Sprintf(unknownCommandResponse, CommandPrefix, handler.Name, CommandPrefix))
+		return fmt.Errorf("unknown command %s", handler.Name)
+	}
+	handler.Command = cmd
+	return nil
+}
+
+func (handler *Router) Handle(ch *amqp.Channel, pushTo *amqp.Queue) error {
+	if handler == nil {
+		return errors.New("no Handler")
+	}
+	ctx := &CommandContext{
+		Message:       handler.Message,
+		PhoneNumberID: handler.PhoneNumberID,
+		Channel:       ch,
+		ConvertQueue:  pushTo,
+	}
+	return handler.Command.Run(ctx, handler.Args)
+}
+
+// Help lists commands, or describes one in detail
+type Help struct{}
+
+func (Help) Name() string      { return "help" }
+func (Help) Aliases() []string { return []string{"h", "?", "start"} }
+func (Help) Usage() string     { return "[command]" }
+func (Help) Help() string      { return "Shows what the bot can do, or how to use a command" }
+
+// usage formats how to call cmd
+func usage(cmd Command) string {
+	line := CommandPrefix + cmd.Name()
+	if cmd.Usage() != "" {
+		line += " " + cmd.Usage()
+	}
+	return line
+}
+
+func (Help) Run(ctx *CommandContext, args []string) error {
+	if len(args) > 0 {
+		cmd, ok := LookupCommand(args[0])
+		if !ok {
+			ctx.Reply(fmt.Sprintf(unknownCommandResponse, CommandPrefix, args[0], CommandPrefix))
+			return nil
+		}
+		body := fmt.Sprintf("%s\n%s", usage(cmd), cmd.Help())
+		if len(cmd.Aliases()) > 0 {
+			body += fmt.Sprintf("\nAlso: %s%s", CommandPrefix, strings.Join(cmd.Aliases(), ", "+CommandPrefix))
+		}
+		ctx.Reply(body)
+		return nil
+	}
+	lines := []string{"Send an image, video, gif or some text and I'll reply with a sticker. Send a sticker to get the image back.", ""}
+	for _, cmd := range registeredCommands() {
+		lines = append(lines, fmt.Sprintf("%s - %s", usage(cmd), cmd.Help()))
+	}
+	ctx.Reply(strings.Join(lines, "\n"))
+	return nil
+}
+
+func init() {
+	RegisterCommand(Help{})
+}
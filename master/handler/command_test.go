@@ -0,0 +1,32 @@
+package handler
+
+import "testing"
+
+func TestParseCommand(t *testing.T) {
+	name, args := ParseCommand(`  /PACK "my pack" me `)
+	if name != "pack" || len(args) != 2 || args[0] != "my pack" || args[1] != "me" {
+		t.Errorf("parsed %q %q", name, args)
+	}
+	if name, args = ParseCommand("/"); name != "" || len(args) != 0 {
+		t.Errorf("bare prefix parsed as %q %q", name, args)
+	}
+}
+
+func TestLookupCommand(t *testing.T) {
+	tests := map[string]string{
+		"help":   "help",
+		"/?":     "help",
+		"START":  "help",
+		"usage":  "stats",
+		"forget": "undo",
+	}
+	for name, want := range tests {
+		cmd, ok := LookupCommand(name)
+		if !ok || cmd.Name() != want {
+			t.Errorf("LookupCommand(%q) found %v, want %s", name, cmd, want)
+		}
+	}
+	if _, ok := LookupCommand("nope"); ok {
+		t.Error("found an unregistered command")
+	}
+}
@@ -2,7 +2,9 @@ package handler
 
 import (
 	"encoding/json"
+	"time"
 
+	"github.com/deven96/whatsticker/master/store"
 	"github.com/deven96/whatsticker/master/whatsapp"
 	"github.com/deven96/whatsticker/utils"
 
@@ -31,13 +33,86 @@ type Handler interface {
 	Handle(ch *amqp.Channel, pushTo *amqp.Queue) error
 }
 
+// replyText : sends body as a text reply to message
+func replyText(message *whatsapp.Message, phoneNumberID string, body string) {
+	response := whatsapp.TextResponse{
+		Response: whatsapp.Response{
+			To:      message.From,
+			Type:    "text",
+			Context: whatsapp.Context{MessageID: message.ID},
+		},
+		Text: whatsapp.Text{
+			Body: body,
+		},
+	}
+	textbytes, _ := json.Marshal(&response)
+	whatsapp.SendMessage(textbytes, phoneNumberID)
+}
+
+func rejectUnsupported(message *whatsapp.Message, phoneNumberID string) {
+	replyText(message, phoneNumberID, "Bot currently supports sticker creation from (video/images/text) and extracting stickers only")
+}
+
+// queueTask publishes task for the worker to convert and records it as queued
+func queueTask(ch *amqp.Channel, pushTo *amqp.Queue, task *utils.ConvertTask) {
+	task.Timings.Queued = time.Now()
+	taskBytes, _ := json.Marshal(task)
+	utils.PublishBytesToQueue(ch, pushTo, taskBytes)
+	store.RecordTask(DB, *task, utils.TaskQueued, "")
+}
+
+// recordReceived starts tracking the task made from message
+func recordReceived(message *whatsapp.Message) {
+	store.RecordTaskAt(DB, message.ID, message.From, message.Type, utils.TaskReceived, "", time.Now())
+}
+
+// recordDownloaded marks the media of message as downloaded
+func recordDownloaded(message *whatsapp.Message, mediaType string) {
+	store.RecordTaskAt(DB, message.ID, message.From, mediaType, utils.TaskDownloaded, "", time.Now())
+}
+
+// trackStatuses marks the tasks answered by delivered messages as delivered
+func trackStatuses(statuses []whatsapp.Status) {
+	if DB == nil {
+		return
+	}
+	for _, status := range statuses {
+		if status.Status != "delivered" {
+			continue
+		}
+		task, err := DB.TaskByReply(status.ID)
+		if err != nil {
+			if err != store.ErrNotFound {
+				log.Errorf("Could not look up task replied to with %s: %s", status.ID, err)
+			}
+			continue
+		}
+		store.RecordTaskAt(DB, task.MessageID, task.PhoneNumber, task.MediaType, utils.TaskDelivered, "", status.At())
+	}
+}
+
+// throttled tells the sender of message they went over a quota, or
+// that their request could not be counted against one
+func throttled(message *whatsapp.Message, phoneNumberID string, err error, metric *utils.StickerizationMetric) {
+	replyText(message, phoneNumberID, quotaResponse(err))
+	over, ok := err.(*ThrottledError)
+	if !ok {
+		log.Errorf("Could not charge quotas of %s: %s", message.From, err)
+		return
+	}
+	log.Infof("Throttling %s: %s", message.From, over)
+	metric.Throttled = over.Quota.Name
+}
+
 // Run : the appropriate handler using the event type
 func Run(event *whatsapp.WhatsappIncomingMessage, ch *amqp.Channel, convertQueue *amqp.Queue, loggingQueue *amqp.Queue) {
 	var handle Handler
 	entry := event.Entry[0]
 	for _, change := range entry.Changes {
+		trackStatuses(change.Value.Statuses)
 		messages := change.Value.Messages
 		for _, message := range messages {
+			message.ReceivedAt = time.Now()
 			log.Debugf("Running for %s type\n", message.Type)
 			messageSender := message.From
 			requestTime := message.Time()
@@ -51,37 +126,97 @@ func Run(event *whatsapp.WhatsappIncomingMessage, ch *amqp.Channel, convertQueue
 				TimeOfRequest:      requestTime,
 				Validated:          false,
 			}
+			// every message gets one access metric, on its own so the
+			// stickerization metrics published later are not counted twice
+			decision := decideAccess(message.From)
+			accessMetric := metric
+			accessMetric.Access = decision
+			accessBytes, _ := json.Marshal(&accessMetric)
+			utils.PublishBytesToQueue(ch, loggingQueue, accessBytes)
+			// refused senders get no reply at all, not even a graph api call
+			if decision != DecisionAllowed {
+				log.Infof("Ignoring %s: %s", message.From, decision)
+				continue
+			}
+			seeUser(message.From)
 			metricBytes, _ := json.Marshal(&metric)
 			log.Println(message.Type)
 			switch message.Type {
 			case "image", "video":
 				log.Debug("Using Media Handler")
 				handle = &Media{}
-			default:
-				failed := whatsapp.TextResponse{
-					Response: whatsapp.Response{
-						To:      message.From,
-						Type:    "text",
-						Context: whatsapp.Context{MessageID: message.ID},
-					},
-					Text: whatsapp.Text{
-						Body: "Bot currently supports sticker creation from (video/images) only",
-					},
+			case "sticker":
+				log.Debug("Using Sticker Handler")
+				handle = &Sticker{}
+			case "text":
+				if IsCommand(message.Text.Body) {
+					log.Debug("Using Command Router")
+					handle = &Router{}
+					break
 				}
-				textbytes, _ := json.Marshal(&failed)
-				whatsapp.SendMessage(textbytes, change.Value.Metadata.PhoneNumberID)
+				if IsGifLink(message.Text.Body) {
+					log.Debug("Using Link Handler")
+					handle = &Link{}
+					break
+				}
+				log.Debug("Using Text Handler")
+				handle = &Text{}
+			case "document":
+				if !message.IsVisualDocument() {
+					rejectUnsupported(&message, change.Value.Metadata.PhoneNumberID)
+					utils.PublishBytesToQueue(ch, loggingQueue, metricBytes)
+					return
+				}
+				log.Debug("Using Media Handler for document")
+				handle = &Media{}
+			default:
+				rejectUnsupported(&message, change.Value.Metadata.PhoneNumberID)
 				utils.PublishBytesToQueue(ch, loggingQueue, metricBytes)
 				return
 			}
+			_, isCommand := handle.(*Router)
+			if !isCommand {
+				if err := checkRequest(message.From); err != nil {
+					throttled(&message, change.Value.Metadata.PhoneNumberID, err, &metric)
+					metricBytes, _ = json.Marshal(&metric)
+					utils.PublishBytesToQueue(ch, loggingQueue, metricBytes)
+					return
+				}
+				recordReceived(&message)
+			}
 			handle.SetUp(&message, change.Value.Metadata.PhoneNumberID)
 			invalid := handle.Validate()
 			if invalid != nil {
 				log.Debugf("Invalid event Data: %s\n", invalid)
+				if !isCommand {
+					store.RecordTaskAt(DB, message.ID, message.From, message.Type, utils.TaskFailed, invalid.Error(), time.Now())
+				}
+				if over, ok := invalid.(*ThrottledError); ok {
+					metric.Throttled = over.Quota.Name
+					metricBytes, _ = json.Marshal(&metric)
+				}
 				utils.PublishBytesToQueue(ch, loggingQueue, metricBytes)
 				return
 			}
+			// only requests that passed validation count against the quotas
+			if !isCommand {
+				if err := admitRequest(message.From); err != nil {
+					throttled(&message, change.Value.Metadata.PhoneNumberID, err, &metric)
+					store.RecordTaskAt(DB, message.ID, message.From, message.Type, utils.TaskFailed, err.Error(), time.Now())
+					metricBytes, _ = json.Marshal(&metric)
+					utils.PublishBytesToQueue(ch, loggingQueue, metricBytes)
+					return
+				}
+			}
 
-			if handle.Handle(ch, convertQueue) != nil {
+			if err := handle.Handle(ch, convertQueue); err != nil {
+				if !isCommand {
+					store.RecordTaskAt(DB, message.ID, message.From, message.Type, utils.TaskFailed, err.Error(), time.Now())
+				}
+				if over, ok := err.(*ThrottledError); ok {
+					metric.Throttled = over.Quota.Name
+					metricBytes, _ = json.Marshal(&metric)
+				}
 				utils.PublishBytesToQueue(ch, loggingQueue, metricBytes)
 			}
 		}
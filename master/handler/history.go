@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/deven96/whatsticker/master/store"
+	"github.com/deven96/whatsticker/master/whatsapp"
+	log "github.com/sirupsen/logrus"
+)
+
+// HistoryLimit is how many recent stickers /history lists and /resend can reach
+const HistoryLimit = 10
+
+// MediaIDLifetime is how long whatsapp keeps uploaded media, after
+// which stickers have to be uploaded again to be sent
+const MediaIDLifetime = 30 * 24 * time.Hour
+
+const noHistoryResponse = "You have no stickers saved yet. Stickers you make from now on are kept unless you send /settings optout history"
+
+// History lists a user's recent stickers
+type History struct{}
+
+func (History) Name() string      { return "history" }
+func (History) Aliases() []string { return []string{"recent"} }
+func (History) Usage() string     { return "" }
+func (History) Help() string      { return "Lists the last stickers you made" }
+
+func (History) Run(ctx *CommandContext, args []string) error {
+	if DB == nil {
+		ctx.Reply("History is not available right now, please try again later")
+		return nil
+	}
+	stickers, err := DB.RecentStickers(ctx.Message.From, HistoryLimit)
+	if err != nil {
+		return err
+	}
+	if len(stickers) == 0 {
+		ctx.Reply(noHistoryResponse)
+		return nil
+	}
+	lines := []string{"Your recent stickers:"}
+	for i, sticker := range stickers {
+		lines = append(lines, fmt.Sprintf("%d. %s from %s", i+1, sticker.CreatedAt.Format("2006-01-02 15:04"), sticker.MediaType))
+	}
+	lines = append(lines, "", fmt.Sprintf("Send %sresend <number> to get one again", CommandPrefix))
+	ctx.Reply(strings.Join(lines, "\n"))
+	return nil
+}
+
+// Resend sends one of a user's recent stickers again
+type Resend struct{}
+
+func (Resend) Name() string      { return "resend" }
+func (Resend) Aliases() []string { return []string{"again"} }
+func (Resend) Usage() string     { return "[number]" }
+func (Resend) Help() string {
+	return "Sends one of your recent stickers again, the last one by default"
+}
+
+func (r Resend) Run(ctx *CommandContext, args []string) error {
+	if DB == nil {
+		ctx.Reply("History is not available right now, please try again later")
+		return nil
+	}
+	n := 1
+	if len(args) > 0 {
+		var err error
+		if n, err = strconv.Atoi(args[0]); err != nil || n < 1 || n > HistoryLimit {
+			ctx.Reply(fmt.Sprintf("Pick a number between 1 and %d from %shistory", HistoryLimit, CommandPrefix))
+			return nil
+		}
+	}
+	stickers, err := DB.RecentStickers(ctx.Message.From, n)
+	if err != nil {
+		return err
+	}
+	if len(stickers) < n {
+		if len(stickers) == 0 {
+			ctx.Reply(noHistoryResponse)
+		} else {
+			ctx.Reply(fmt.Sprintf("You only have %d stickers saved, see %shistory", len(stickers), CommandPrefix))
+		}
+		return nil
+	}
+	return resendSticker(ctx, stickers[n-1])
+}
+
+// resendSticker sends a kept sticker by its media ID while that is
+// still valid, uploading it again when it expired or sending fails
+func resendSticker(ctx *CommandContext, sticker store.Sticker) error {
+	from, messageID := ctx.Message.From, ctx.Message.ID
+	if sticker.MediaID != "" && time.Since(sticker.UploadedAt) < MediaIDLifetime {
+		_, err := whatsapp.SendSticker(from, messageID, sticker.MediaID, ctx.PhoneNumberID)
+		if err == nil {
+			return nil
+		}
+		log.Infof("Could not resend sticker %d as %s, uploading it again: %s", sticker.ID, sticker.MediaID, err)
+	}
+	id, err := whatsapp.UploadSticker(store.StickerPath(sticker.StorageKey), ctx.PhoneNumberID)
+	if err != nil {
+		ctx.Reply("Sorry, that sticker could not be sent again")
+		return err
+	}
+	if err = DB.SetStickerMedia(sticker.ID, id, time.Now().UTC()); err != nil {
+		log.Errorf("Could not record upload of sticker %d: %s", sticker.ID, err)
+	}
+	_, err = whatsapp.SendSticker(from, messageID, id, ctx.PhoneNumberID)
+	return err
+}
+
+// Undo forgets the last sticker a user made
+type Undo struct{}
+
+func (Undo) Name() string      { return "undo" }
+func (Undo) Aliases() []string { return []string{"forget"} }
+func (Undo) Usage() string     { return "" }
+func (Undo) Help() string      { return "Removes the last sticker you made from your history" }
+
+func (Undo) Run(ctx *CommandContext, args []string) error {
+	if DB == nil {
+		ctx.Reply("History is not available right now, please try again later")
+		return nil
+	}
+	stickers, err := DB.RecentStickers(ctx.Message.From, 1)
+	if err != nil {
+		return err
+	}
+	if len(stickers) == 0 {
+		ctx.Reply(noHistoryResponse)
+		return nil
+	}
+	sticker := stickers[0]
+	if err = DB.DeleteSticker(sticker.ID); err != nil {
+		return err
+	}
+	if err = os.Remove(store.StickerPath(sticker.StorageKey)); err != nil && !os.IsNotExist(err) {
+		log.Errorf("Could not remove kept sticker %d: %s", sticker.ID, err)
+	}
+	ctx.Reply(fmt.Sprintf("Removed your sticker from %s made from %s", sticker.CreatedAt.Format("2006-01-02 15:04"), sticker.MediaType))
+	return nil
+}
+
+func init() {
+	RegisterCommand(History{})
+	RegisterCommand(Resend{})
+	RegisterCommand(Undo{})
+}
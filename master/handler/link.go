@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/deven96/whatsticker/master/whatsapp"
+	"github.com/deven96/whatsticker/utils"
+	amqp "github.com/rabbitmq/amqp091-go"
+	log "github.com/sirupsen/logrus"
+)
+
+const notAGifResponse = "That link does not point to a gif"
+const linkTooLargeResponse = "That gif is beyond conversion size %dkb"
+const linkUnreachableResponse = "That link could not be fetched, please check it and try again"
+
+// linkClient fetches links sent by anyone, so it refuses to reach
+// addresses on the bot's own network whatever the link or its redirects say
+var linkClient = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: refusePrivate,
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 5 {
+			return errors.New("too many redirects")
+		}
+		if !fetchable(req.URL) {
+			return fmt.Errorf("refusing redirect to %s", req.URL)
+		}
+		return nil
+	},
+}
+
+// fetchable : links with a scheme and host the bot will fetch
+func fetchable(link *url.URL) bool {
+	return (link.Scheme == "http" || link.Scheme == "https") && link.Hostname() != ""
+}
+
+// publicIP : addresses that are not on a private, local or special network
+func publicIP(ip net.IP) bool {
+	return !(ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() || ip.IsUnspecified())
+}
+
+// refusePrivate is called with the resolved address of every connection
+// linkClient makes, so names resolving to private addresses are refused too
+func refusePrivate(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !publicIP(ip) {
+		return fmt.Errorf("refusing to connect to %s", address)
+	}
+	return nil
+}
+
+// IsGifLink : text messages which are nothing but a link to a gif
+func IsGifLink(body string) bool {
+	body = strings.TrimSpace(body)
+	if strings.ContainsAny(body, " \n\t") {
+		return false
+	}
+	parsed, err := url.Parse(body)
+	if err != nil || !fetchable(parsed) {
+		return false
+	}
+	return strings.HasSuffix(strings.ToLower(parsed.Path), ".gif")
+}
+
+// Link stickerizes a gif sent as a link rather than as media
+type Link struct {
+	RawPath       string
+	ConvertedPath string
+	Message       *whatsapp.Message
+	PhoneNumberID string
+	URL           string
+	Len           int
+}
+
+func (handler *Link) SetUp(message *whatsapp.Message, phoneNumberID string) {
+	handler.Message = message
+	handler.PhoneNumberID = phoneNumberID
+	handler.URL = strings.TrimSpace(message.Text.Body)
+
+	newpath := filepath.Join(".", "gifs/raw")
+	os.MkdirAll(newpath, os.ModePerm)
+	newpath = filepath.Join(".", "gifs/converted")
+	os.MkdirAll(newpath, os.ModePerm)
+}
+
+func (handler *Link) Validate() error {
+	if handler == nil {
+		return errors.New("please initialize handler")
+	}
+	if err := checkVideo(handler.Message.From); err != nil {
+		replyText(handler.Message, handler.PhoneNumberID, err.(*ThrottledError).Response())
+		return err
+	}
+	resp, err := linkClient.Head(handler.URL)
+	if err != nil {
+		replyText(handler.Message, handler.PhoneNumberID, linkUnreachableResponse)
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		replyText(handler.Message, handler.PhoneNumberID, linkUnreachableResponse)
+		return fmt.Errorf("checking %s returned %s", handler.URL, resp.Status)
+	}
+	if resp.ContentLength > ImageFileSizeLimit {
+		replyText(handler.Message, handler.PhoneNumberID, fmt.Sprintf(linkTooLargeResponse, ImageFileSizeLimit/1024))
+		return errors.New("gif too large")
+	}
+	return nil
+}
+
+// linkTooLargeError : the sender has already been told the gif is too large
+type linkTooLargeError struct{}
+
+func (*linkTooLargeError) Error() string { return "gif too large" }
+
+// download fetches the link to RawPath, refusing to read beyond the
+// size limit since the content length of a link cannot be trusted
+func (handler *Link) download() error {
+	resp, err := linkClient.Get(handler.URL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching %s returned %s", handler.URL, resp.Status)
+	}
+	out, err := os.Create(handler.RawPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	written, err := io.Copy(out, io.LimitReader(resp.Body, ImageFileSizeLimit+1))
+	if err != nil {
+		return err
+	}
+	if written > ImageFileSizeLimit {
+		replyText(handler.Message, handler.PhoneNumberID, fmt.Sprintf(linkTooLargeResponse, ImageFileSizeLimit/1024))
+		return &linkTooLargeError{}
+	}
+	handler.Len = int(written)
+	return nil
+}
+
+func (handler *Link) Handle(ch *amqp.Channel, pushTo *amqp.Queue) error {
+	if handler == nil {
+		return errors.New("no Handler")
+	}
+	message := handler.Message
+	handler.RawPath = fmt.Sprintf("gifs/raw/%s.gif", message.ID)
+	handler.ConvertedPath = fmt.Sprintf("gifs/converted/%s%s", message.ID, WebPFormat)
+	timings := utils.Timings{Received: message.ReceivedAt, DownloadStarted: time.Now()}
+	if err := handler.download(); err != nil {
+		log.Errorf("Failed to download gif link: %v\n", err)
+		os.Remove(handler.RawPath)
+		if _, tooLarge := err.(*linkTooLargeError); !tooLarge {
+			replyText(message, handler.PhoneNumberID, linkUnreachableResponse)
+		}
+		return err
+	}
+	timings.Downloaded = time.Now()
+	recordDownloaded(message, "gif")
+	if mimeType, err := sniffMediaType(handler.RawPath); err != nil || mimeType != "image/gif" {
+		os.Remove(handler.RawPath)
+		replyText(message, handler.PhoneNumberID, notAGifResponse)
+		return fmt.Errorf("link is %s not a gif", mimeType)
+	}
+	probe, err := Probe(handler.RawPath, "gif")
+	if err != nil {
+		log.Infof("Rejecting %s after probing: %s", handler.RawPath, err)
+		os.Remove(handler.RawPath)
+		if rejected, ok := err.(*UnsupportedMediaError); ok {
+			replyText(message, handler.PhoneNumberID, rejected.Reason)
+		}
+		return err
+	}
+	if err = chargeVideo(message.From, probe.Duration); err != nil {
+		os.Remove(handler.RawPath)
+		replyText(message, handler.PhoneNumberID, quotaResponse(err))
+		return err
+	}
+	digest, err := fileSHA256(handler.RawPath)
+	if err != nil {
+		log.Errorf("Failed to hash %s: %s", handler.RawPath, err)
+	}
+	user := lookupUser(message.From)
+	convertTask := &utils.ConvertTask{
+		MediaPath:     handler.RawPath,
+		ConvertedPath: handler.ConvertedPath,
+		DataLen:       handler.Len,
+		MediaType:     "gif",
+		Probe:         probe,
+		MessageID:     message.ID,
+		From:          message.From,
+		PhoneNumberID: handler.PhoneNumberID,
+		IsGroup:       message.IsGroup(),
+		MessageSender: message.From,
+		TimeOfRequest: message.Time(),
+		Options:       userDefaults(user),
+		Language:      userLanguage(user),
+		SourceSHA256:  digest,
+		Timings:       timings,
+	}
+	queueTask(ch, pushTo, convertTask)
+	return nil
+}
@@ -0,0 +1,43 @@
+package handler
+
+import "testing"
+
+func TestIsGifLink(t *testing.T) {
+	tests := map[string]bool{
+		"https://media.example.com/cat.gif":  true,
+		" http://example.com/a/b/DOG.GIF \n": true,
+		"ftp://example.com/cat.gif":          false,
+		"file:///etc/cat.gif":                false,
+		"https://example.com/cat.png":        false,
+		"look https://example.com/cat.gif":   false,
+		"https:///cat.gif":                   false,
+	}
+	for body, want := range tests {
+		if got := IsGifLink(body); got != want {
+			t.Errorf("IsGifLink(%q) = %t, want %t", body, got, want)
+		}
+	}
+}
+
+func TestRefusePrivate(t *testing.T) {
+	tests := map[string]bool{
+		"93.184.216.34:443":     true,
+		"[2606:4700::1111]:80":  true,
+		"127.0.0.1:80":          false,
+		"10.1.2.3:80":           false,
+		"172.16.0.1:80":         false,
+		"192.168.1.1:80":        false,
+		"169.254.169.254:80":    false,
+		"0.0.0.0:80":            false,
+		"224.0.0.1:80":          false,
+		"[::1]:80":              false,
+		"[fe80::1]:80":          false,
+		"[fd00::1]:80":          false,
+		"[::ffff:127.0.0.1]:80": false,
+	}
+	for address, allowed := range tests {
+		if err := refusePrivate("tcp", address, nil); (err == nil) != allowed {
+			t.Errorf("refusePrivate(%q) = %v, want allowed %t", address, err, allowed)
+		}
+	}
+}
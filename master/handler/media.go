@@ -1,13 +1,20 @@
 package handler
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"mime"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/deven96/whatsticker/master/store"
 	"github.com/deven96/whatsticker/master/whatsapp"
 	"github.com/deven96/whatsticker/utils"
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -15,7 +22,8 @@ import (
 )
 
 const whatsappErrorResponse = "Your %s size %dkb beyond conversion size %dkb"
-const headsUpVideoMessage = "Your video might take a bit longer to stickerize"
+const headsUpVideoMessage = "Your %s might take a bit longer to stickerize"
+const unsupportedDocumentResponse = "Your file does not look like an image or video"
 
 type Media struct {
 	RawPath       string
@@ -32,6 +40,9 @@ func (handler *Media) SetUp(message *whatsapp.Message, phoneNumberID string) {
 	handler.Message = message
 	handler.PhoneNumberID = phoneNumberID
 	handler.MediaType = message.Type
+	if message.IsDocument() {
+		handler.MediaType = kindOf(message.MediaType())
+	}
 
 	newpath := filepath.Join(".", fmt.Sprintf("%ss/raw", handler.MediaType))
 	os.MkdirAll(newpath, os.ModePerm)
@@ -39,9 +50,54 @@ func (handler *Media) SetUp(message *whatsapp.Message, phoneNumberID string) {
 	os.MkdirAll(newpath, os.ModePerm)
 }
 
+// kindOf maps a mime type onto the image, gif or video pipeline
+func kindOf(mimeType string) string {
+	if mimeType == "image/gif" {
+		return "gif"
+	}
+	if strings.HasPrefix(mimeType, "video/") {
+		return "video"
+	}
+	if strings.HasPrefix(mimeType, "image/") {
+		return "image"
+	}
+	return ""
+}
+
+// sniffMediaType detects the mime type of the file at path from its
+// contents, since the mime_type whatsapp reports is whatever the
+// sender's device claimed
+func sniffMediaType(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	header := make([]byte, 512)
+	n, err := file.Read(header)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return http.DetectContentType(header[:n]), nil
+}
+
+// fileSHA256 returns the hex sha256 digest of the file at path
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err = io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
 func (handler *Media) sizeLimit() int {
-	// we dealing with just images and videos so we good
-	if handler.MediaType == "image" {
+	// we dealing with just images, gifs and videos so we good
+	if handler.MediaType == "image" || handler.MediaType == "gif" {
 		return ImageFileSizeLimit
 	} else {
 		return VideoFileSizeLimit
@@ -57,7 +113,7 @@ func (handler *Media) sendHeadsUpMessage() error {
 			Context: whatsapp.Context{MessageID: message.ID},
 		},
 		Text: whatsapp.Text{
-			Body: headsUpVideoMessage,
+			Body: fmt.Sprintf(headsUpVideoMessage, handler.MediaType),
 		},
 	}
 	textbytes, _ := json.Marshal(&infoMessage)
@@ -94,7 +150,14 @@ func (handler *Media) Validate() error {
 	handler.MediaURL = meta.URL
 	handler.Len = meta.FileSize
 
-	if handler.MediaType == "video" {
+	if handler.MediaType == "video" || handler.MediaType == "gif" {
+		if err = checkVideo(message.From); err != nil {
+			replyText(message, handler.PhoneNumberID, err.(*ThrottledError).Response())
+			return err
+		}
+		if user := lookupUser(message.From); user != nil && user.OptedOut(store.OptOutHeadsUp) {
+			return nil
+		}
 		err = handler.sendHeadsUpMessage()
 		if err != nil {
 			return err
@@ -103,23 +166,92 @@ func (handler *Media) Validate() error {
 	return nil
 }
 
+// extensionFor picks the conventional extension for mimeType since
+// mime.ExtensionsByType returns them in alphabetical order (.jfif before .jpg)
+func extensionFor(mimeType string, exts []string) string {
+	switch mimeType {
+	case "image/jpeg":
+		return ".jpg"
+	case "image/png":
+		return ".png"
+	case "image/webp":
+		return ".webp"
+	case "image/gif":
+		return ".gif"
+	case "video/mp4":
+		return ".mp4"
+	}
+	if len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
 func (handler *Media) Handle(ch *amqp.Channel, pushTo *amqp.Queue) error {
 	if handler == nil {
 		return errors.New("no Handler")
 	}
 	// Download Media
 	message := handler.Message
-	exts, _ := mime.ExtensionsByType(message.MediaType())
-	handler.RawPath = fmt.Sprintf("%ss/raw/%s%s", handler.MediaType, message.MediaID(), exts[0])
-	handler.ConvertedPath = fmt.Sprintf("%ss/converted/%s%s", handler.MediaType, message.MediaID(), WebPFormat)
-	err := message.DownloadMedia(handler.RawPath, handler.MediaURL)
+	// sniffing may move the media to another pipeline but it stays
+	// in the directories SetUp created
+	dir := handler.MediaType + "s"
+	downloadPath := fmt.Sprintf("%s/raw/%s", dir, message.MediaID())
+	timings := utils.Timings{Received: message.ReceivedAt, DownloadStarted: time.Now()}
+	err := message.DownloadMedia(downloadPath, handler.MediaURL)
 	if err != nil {
 		log.Errorf("Failed to download %ss: %v\n", handler.MediaType, err)
 		return err
 	}
+	timings.Downloaded = time.Now()
+	recordDownloaded(message, handler.MediaType)
+	mimeType, err := sniffMediaType(downloadPath)
+	if err != nil {
+		os.Remove(downloadPath)
+		return err
+	}
+	if kind := kindOf(mimeType); kind != "" {
+		handler.MediaType = kind
+	} else if message.IsDocument() {
+		log.Debugf("Rejecting document sniffed as %s", mimeType)
+		os.Remove(downloadPath)
+		replyText(message, handler.PhoneNumberID, unsupportedDocumentResponse)
+		return fmt.Errorf("unsupported document type %s", mimeType)
+	} else {
+		// fall back to what whatsapp reported for formats we cannot sniff
+		mimeType = message.MediaType()
+	}
+	exts, _ := mime.ExtensionsByType(mimeType)
+	handler.RawPath = downloadPath + extensionFor(mimeType, exts)
+	handler.ConvertedPath = fmt.Sprintf("%s/converted/%s%s", dir, message.MediaID(), WebPFormat)
+	if err = os.Rename(downloadPath, handler.RawPath); err != nil {
+		os.Remove(downloadPath)
+		return err
+	}
+	probe, err := Probe(handler.RawPath, handler.MediaType)
+	if err != nil {
+		log.Infof("Rejecting %s after probing: %s", handler.RawPath, err)
+		os.Remove(handler.RawPath)
+		if rejected, ok := err.(*UnsupportedMediaError); ok {
+			replyText(message, handler.PhoneNumberID, rejected.Reason)
+		}
+		return err
+	}
+	if handler.MediaType == "video" || handler.MediaType == "gif" {
+		if err = chargeVideo(message.From, probe.Duration); err != nil {
+			os.Remove(handler.RawPath)
+			replyText(message, handler.PhoneNumberID, quotaResponse(err))
+			return err
+		}
+	}
+	digest, err := fileSHA256(handler.RawPath)
+	if err != nil {
+		log.Errorf("Failed to hash %s: %s", handler.RawPath, err)
+	}
 	messageSender := message.From
 	requestTime := message.Time()
 	isgroupMessage := message.IsGroup()
+	user := lookupUser(message.From)
 	convertTask := &utils.ConvertTask{
 		MediaPath:     handler.RawPath,
 		ConvertedPath: handler.ConvertedPath,
@@ -131,8 +263,12 @@ func (handler *Media) Handle(ch *amqp.Channel, pushTo *amqp.Queue) error {
 		IsGroup:       isgroupMessage,
 		MessageSender: messageSender,
 		TimeOfRequest: requestTime,
+		Options:       ParseOptions(message.Caption(), userDefaults(user)),
+		Probe:         probe,
+		Language:      userLanguage(user),
+		SourceSHA256:  digest,
+		Timings:       timings,
 	}
-	taskBytes, _ := json.Marshal(convertTask)
-	utils.PublishBytesToQueue(ch, pushTo, taskBytes)
+	queueTask(ch, pushTo, convertTask)
 	return nil
 }
@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/deven96/whatsticker/utils"
+)
+
+// splitCaption splits a caption on whitespace, keeping double quoted
+// values such as top="hello there" together
+func splitCaption(caption string) []string {
+	var tokens []string
+	var current strings.Builder
+	quoted := false
+	for _, r := range caption {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case unicode.IsSpace(r) && !quoted:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
+}
+
+// DefaultOutlineWidth is used when outline is given without a width
+const DefaultOutlineWidth = 8
+
+// MaxOutlineWidth keeps outlines from swallowing the sticker
+const MaxOutlineWidth = 32
+
+// MinSpeed and MaxSpeed bound the playback speed of videos
+const (
+	MinSpeed = 0.25
+	MaxSpeed = 4
+)
+
+// CaptionTextLimit caps text drawn over a sticker
+const CaptionTextLimit = 60
+
+// intValue parses the value of a key=value token, returning fallback
+// when there is no value and clamping it to [min, max]
+func intValue(token string, fallback int, min int, max int) int {
+	i := strings.Index(token, "=")
+	if i < 0 {
+		return fallback
+	}
+	value, err := strconv.Atoi(token[i+1:])
+	if err != nil {
+		return fallback
+	}
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
+
+// stringValue returns the value of a key=value token, cut down to
+// CaptionTextLimit characters
+func stringValue(token string) string {
+	i := strings.Index(token, "=")
+	if i < 0 {
+		return ""
+	}
+	value := []rune(strings.TrimSpace(token[i+1:]))
+	if len(value) > CaptionTextLimit {
+		value = value[:CaptionTextLimit]
+	}
+	return string(value)
+}
+
+func isMask(shape string) bool {
+	switch shape {
+	case "circle", "rounded", "heart", "star":
+		return true
+	}
+	return false
+}
+
+// secondsValue parses the value of a key=value token given in
+// seconds (2.5) or minutes and seconds (1:05)
+func secondsValue(token string) float64 {
+	value := stringValue(token)
+	minutes := 0.0
+	if i := strings.Index(value, ":"); i >= 0 {
+		m, err := strconv.ParseFloat(value[:i], 64)
+		if err != nil {
+			return 0
+		}
+		minutes, value = m, value[i+1:]
+	}
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil || seconds < 0 || minutes < 0 {
+		return 0
+	}
+	return minutes*60 + seconds
+}
+
+// speedValue parses a playback speed such as 2 or 0.5x, clamped to
+// between MinSpeed and MaxSpeed
+func speedValue(token string) float64 {
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(strings.ToLower(stringValue(token)), "x"), 64)
+	if err != nil || speed <= 0 {
+		return 0
+	}
+	return math.Max(MinSpeed, math.Min(speed, MaxSpeed))
+}
+
+// OptionPrefix marks option words in captions that are not only options
+const OptionPrefix = "#"
+
+// optionKeys are the words ParseOptions understands
+var optionKeys = map[string]bool{
+	"trim": true, "nobg": true, "outline": true, "shadow": true,
+	"top": true, "bottom": true, "banner": true,
+	"circle": true, "rounded": true, "heart": true, "star": true, "mask": true,
+	"start": true, "end": true, "speed": true, "fast": true, "slow": true,
+	"reverse": true, "boomerang": true,
+	"cover": true, "fill": true, "contain": true, "fit": true,
+}
+
+// optionKey returns the lower cased key of a word or key=value token
+func optionKey(token string) string {
+	if i := strings.Index(token, "="); i >= 0 {
+		token = token[:i]
+	}
+	return strings.ToLower(token)
+}
+
+// onlyOptions : captions made up of nothing but option words
+func onlyOptions(tokens []string) bool {
+	for _, token := range tokens {
+		if !optionKeys[optionKey(strings.TrimPrefix(token, OptionPrefix))] {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseOptions reads conversion options out of a media caption on top
+// of the sender's defaults. Words are only taken as options when they
+// carry the OptionPrefix e.g "my cat #heart", or when the caption is
+// nothing but options e.g "trim outline", so ordinary captions that
+// happen to contain an option word don't change the sticker
+func ParseOptions(caption string, defaults utils.ConvertOptions) utils.ConvertOptions {
+	options := defaults
+	tokens := splitCaption(caption)
+	bare := onlyOptions(tokens)
+	for _, token := range tokens {
+		if !bare && !strings.HasPrefix(token, OptionPrefix) {
+			continue
+		}
+		token = strings.TrimPrefix(token, OptionPrefix)
+		key := optionKey(token)
+		switch key {
+		case "trim":
+			options.Trim = true
+		case "nobg":
+			options.RemoveBackground = utils.FeatureEnabled(utils.FeatureBackgroundRemoval)
+		case "outline":
+			options.Outline = intValue(token, DefaultOutlineWidth, 1, MaxOutlineWidth)
+		case "shadow":
+			options.Shadow = true
+		case "top":
+			options.TopText = stringValue(token)
+		case "bottom":
+			options.BottomText = stringValue(token)
+		case "banner":
+			options.Banner = stringValue(token)
+		case "circle", "rounded", "heart", "star":
+			options.Mask = key
+		case "start":
+			options.Start = secondsValue(token)
+		case "end":
+			options.End = secondsValue(token)
+		case "speed":
+			options.Speed = speedValue(token)
+		case "fast":
+			options.Speed = 2
+		case "slow":
+			options.Speed = 0.5
+		case "reverse":
+			options.Reverse = true
+		case "boomerang":
+			options.Boomerang = true
+		case "cover", "fill":
+			options.Fit = utils.FitCover
+		case "contain", "fit":
+			options.Fit = utils.FitContain
+		case "mask":
+			if mask := strings.ToLower(stringValue(token)); isMask(mask) {
+				options.Mask = mask
+			}
+		}
+	}
+	return options
+}
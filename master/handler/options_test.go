@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/deven96/whatsticker/utils"
+)
+
+func TestSplitCaption(t *testing.T) {
+	got := splitCaption(`  top="hello there"  outline=4 "bottom=a b"`)
+	want := []string{"top=hello there", "outline=4", "bottom=a b"}
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("token %d is %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseOptions(t *testing.T) {
+	utils.SetFeature(utils.FeatureBackgroundRemoval, true)
+	defaults := utils.ConvertOptions{Fit: utils.FitCover, PackName: "mine"}
+	tests := []struct {
+		caption string
+		want    utils.ConvertOptions
+	}{
+		{"", defaults},
+		{"TRIM nobg", utils.ConvertOptions{Trim: true, RemoveBackground: true, Fit: utils.FitCover, PackName: "mine"}},
+		{"outline", utils.ConvertOptions{Outline: DefaultOutlineWidth, Fit: utils.FitCover, PackName: "mine"}},
+		{"outline=100 shadow", utils.ConvertOptions{Outline: MaxOutlineWidth, Shadow: true, Fit: utils.FitCover, PackName: "mine"}},
+		{"outline=0", utils.ConvertOptions{Outline: 1, Fit: utils.FitCover, PackName: "mine"}},
+		{"outline=wide", utils.ConvertOptions{Outline: DefaultOutlineWidth, Fit: utils.FitCover, PackName: "mine"}},
+		{`top="when it works" bottom=finally`, utils.ConvertOptions{TopText: "when it works", BottomText: "finally", Fit: utils.FitCover, PackName: "mine"}},
+		{"heart contain", utils.ConvertOptions{Mask: "heart", Fit: utils.FitContain, PackName: "mine"}},
+		{"mask=STAR", utils.ConvertOptions{Mask: "star", Fit: utils.FitCover, PackName: "mine"}},
+		{"mask=square", defaults},
+		{"start=1:05 end=70.5", utils.ConvertOptions{Start: 65, End: 70.5, Fit: utils.FitCover, PackName: "mine"}},
+		{"start=-2", defaults},
+		{"speed=2x reverse", utils.ConvertOptions{Speed: 2, Reverse: true, Fit: utils.FitCover, PackName: "mine"}},
+		{"speed=100", utils.ConvertOptions{Speed: MaxSpeed, Fit: utils.FitCover, PackName: "mine"}},
+		{"speed=0.1", utils.ConvertOptions{Speed: MinSpeed, Fit: utils.FitCover, PackName: "mine"}},
+		{"slow boomerang", utils.ConvertOptions{Speed: 0.5, Boomerang: true, Fit: utils.FitCover, PackName: "mine"}},
+		{"#trim #heart", utils.ConvertOptions{Trim: true, Mask: "heart", Fit: utils.FitCover, PackName: "mine"}},
+		{"my heart will go on", defaults},
+		{"trim the fat", defaults},
+		{"going fast", defaults},
+		{`my cat #heart #top="hello there" star`, utils.ConvertOptions{Mask: "heart", TopText: "hello there", Fit: utils.FitCover, PackName: "mine"}},
+		{"#Reverse but not slow", utils.ConvertOptions{Reverse: true, Fit: utils.FitCover, PackName: "mine"}},
+		{"#unknown", defaults},
+	}
+	for _, test := range tests {
+		if got := ParseOptions(test.caption, defaults); got != test.want {
+			t.Errorf("ParseOptions(%q) = %+v, want %+v", test.caption, got, test.want)
+		}
+	}
+}
+
+func TestParseOptionsRespectsFeatures(t *testing.T) {
+	utils.SetFeature(utils.FeatureBackgroundRemoval, false)
+	defer utils.SetFeature(utils.FeatureBackgroundRemoval, true)
+	if options := ParseOptions("nobg", utils.ConvertOptions{}); options.RemoveBackground {
+		t.Error("nobg removed the background with the feature off")
+	}
+}
@@ -0,0 +1,146 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"github.com/deven96/whatsticker/utils"
+)
+
+// MaxImageDimension rejects images large enough to exhaust the worker
+// while decoding, whatever their file size
+const MaxImageDimension = 8192
+
+// supportedCodecs are the video codecs the worker's ffmpeg can decode
+var supportedCodecs = map[string]bool{
+	"h264": true, "hevc": true, "vp8": true, "vp9": true, "av1": true,
+	"mpeg4": true, "h263": true, "gif": true, "webp": true, "png": true, "mjpeg": true,
+}
+
+// UnsupportedMediaError is returned for media which downloaded fine
+// but cannot be turned into a sticker, Reason is meant for the sender
+type UnsupportedMediaError struct {
+	Reason string
+}
+
+func (e *UnsupportedMediaError) Error() string {
+	return e.Reason
+}
+
+func unsupported(format string, args ...interface{}) error {
+	return &UnsupportedMediaError{Reason: fmt.Sprintf(format, args...)}
+}
+
+type ffprobeOutput struct {
+	Streams []struct {
+		CodecName     string `json:"codec_name"`
+		Width         int    `json:"width"`
+		Height        int    `json:"height"`
+		NbReadPackets string `json:"nb_read_packets"`
+	} `json:"streams"`
+	Format struct {
+		Duration string `json:"duration"`
+	} `json:"format"`
+}
+
+// probeStream reads the first picture stream of the media at path with
+// ffprobe, kind (image/gif/video) names the media in replies
+func probeStream(path string, kind string) (*utils.MediaProbe, error) {
+	out, err := exec.Command("ffprobe", "-v", "error", "-select_streams", "v:0", "-count_packets",
+		"-show_entries", "stream=codec_name,width,height,nb_read_packets:format=duration",
+		"-of", "json", path).Output()
+	if err != nil {
+		return nil, unsupported("Your %s could not be read, it may be corrupt", kind)
+	}
+	var parsed ffprobeOutput
+	if err = json.Unmarshal(out, &parsed); err != nil {
+		return nil, err
+	}
+	if len(parsed.Streams) == 0 {
+		return nil, unsupported("Your %s has no picture in it", kind)
+	}
+	stream := parsed.Streams[0]
+	probe := &utils.MediaProbe{
+		Codec:  stream.CodecName,
+		Width:  stream.Width,
+		Height: stream.Height,
+	}
+	probe.Frames, _ = strconv.Atoi(stream.NbReadPackets)
+	probe.Duration, _ = strconv.ParseFloat(parsed.Format.Duration, 64)
+	return probe, nil
+}
+
+// probeVideo checks the video or gif at path has frames the worker can decode
+func probeVideo(path string, kind string) (*utils.MediaProbe, error) {
+	probe, err := probeStream(path, kind)
+	if err != nil {
+		return probe, err
+	}
+	if !supportedCodecs[probe.Codec] {
+		return probe, unsupported("Videos encoded with %s are not supported yet", probe.Codec)
+	}
+	if probe.Frames == 0 || probe.Width == 0 || probe.Height == 0 {
+		return probe, unsupported("Your %s has no frames that could be read", kind)
+	}
+	return probe, nil
+}
+
+// probeImage decodes just the header of the image at path, asking
+// ffprobe about formats the standard library cannot read (webp)
+func probeImage(path string) (*utils.MediaProbe, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	config, format, err := image.DecodeConfig(file)
+	if err != nil {
+		probe, err := probeStream(path, "image")
+		if err != nil {
+			return probe, err
+		}
+		// an image is a single picture however ffprobe counts it
+		probe.Frames, probe.Duration = 1, 0
+		if probe.Width == 0 || probe.Height == 0 {
+			return probe, unsupported("Your image is empty")
+		}
+		return probe, nil
+	}
+	probe := &utils.MediaProbe{
+		Codec:  format,
+		Width:  config.Width,
+		Height: config.Height,
+		Frames: 1,
+	}
+	if probe.Width == 0 || probe.Height == 0 {
+		return probe, unsupported("Your image is empty")
+	}
+	return probe, nil
+}
+
+// Probe : checks downloaded media of the given kind (image/gif/video)
+// can be decoded, returning what was learnt about it. Media that cannot
+// be stickerized returns an *UnsupportedMediaError
+func Probe(path string, kind string) (*utils.MediaProbe, error) {
+	var probe *utils.MediaProbe
+	var err error
+	if kind == "image" {
+		probe, err = probeImage(path)
+	} else {
+		probe, err = probeVideo(path, kind)
+	}
+	if err != nil {
+		return probe, err
+	}
+	if probe.Width > MaxImageDimension || probe.Height > MaxImageDimension {
+		return probe, unsupported("Your %s is %dx%d, the largest supported is %dx%d", kind, probe.Width, probe.Height, MaxImageDimension, MaxImageDimension)
+	}
+	return probe, nil
+}
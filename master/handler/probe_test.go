@@ -0,0 +1,40 @@
+package handler
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProbeImage(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.png")
+	out, err := os.Create(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	png.Encode(out, image.NewNRGBA(image.Rect(0, 0, 40, 30)))
+	out.Close()
+	probe, err := Probe(valid, "image")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if probe.Codec != "png" || probe.Width != 40 || probe.Height != 30 || probe.Frames != 1 {
+		t.Errorf("probed %+v", probe)
+	}
+
+	corrupt := filepath.Join(dir, "corrupt.png")
+	if err = os.WriteFile(corrupt, []byte("\x89PNG\r\n\x1a\nnot really"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = Probe(corrupt, "image")
+	rejected, ok := err.(*UnsupportedMediaError)
+	if !ok {
+		t.Fatalf("corrupt image returned %v", err)
+	}
+	if rejected.Reason != "Your image could not be read, it may be corrupt" {
+		t.Errorf("corrupt image rejected with %q", rejected.Reason)
+	}
+}
@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/deven96/whatsticker/master/store"
+	"github.com/deven96/whatsticker/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+const throttledResponse = "You have reached the limit of %s, please try again %s"
+const quotaUnavailableResponse = "Your request could not be counted right now, please try again later"
+
+// Quota : limits how much of a kind of usage a sender gets per window
+type Quota struct {
+	Name   string // reported in metrics
+	Usage  string // store.UsageRequests or store.UsageVideoSeconds
+	Limit  float64
+	Window time.Duration
+	Reason string // described to throttled senders
+}
+
+// quotaLimit reads a limit from the env var name, 0 turns the quota off
+func quotaLimit(name string, fallback float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(name), 64)
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
+
+// requestQuotas limit how many stickers a sender can ask for
+func requestQuotas() []Quota {
+	return []Quota{
+		{
+			Name:   "requests_per_minute",
+			Usage:  store.UsageRequests,
+			Limit:  quotaLimit("QUOTA_REQUESTS_PER_MINUTE", 10),
+			Window: time.Minute,
+			Reason: "stickers per minute",
+		},
+		{
+			Name:   "requests_per_day",
+			Usage:  store.UsageRequests,
+			Limit:  quotaLimit("QUOTA_REQUESTS_PER_DAY", 200),
+			Window: 24 * time.Hour,
+			Reason: "stickers per day",
+		},
+	}
+}
+
+// videoQuota limits how many seconds of video a sender can have converted
+func videoQuota() Quota {
+	return Quota{
+		Name:   "video_seconds_per_day",
+		Usage:  store.UsageVideoSeconds,
+		Limit:  quotaLimit("QUOTA_VIDEO_SECONDS_PER_DAY", 300),
+		Window: 24 * time.Hour,
+		Reason: "video stickers per day",
+	}
+}
+
+// ThrottledError : a sender went over a quota
+type ThrottledError struct {
+	Quota   Quota
+	RetryAt time.Time
+}
+
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("over %s quota until %s", e.Quota.Name, e.RetryAt.Format(time.RFC3339))
+}
+
+// Response : tells the sender when they can try again
+func (e *ThrottledError) Response() string {
+	wait := time.Until(e.RetryAt)
+	when := "at " + e.RetryAt.UTC().Format("15:04 UTC")
+	switch {
+	case wait < time.Minute:
+		when = fmt.Sprintf("in %d seconds", int(math.Max(1, math.Ceil(wait.Seconds()))))
+	case wait < time.Hour:
+		when = fmt.Sprintf("in %d minutes", int(math.Ceil(wait.Minutes())))
+	}
+	return fmt.Sprintf(throttledResponse, e.Quota.Reason, when)
+}
+
+// quotaResponse tells a sender why chargeQuotas refused them
+func quotaResponse(err error) string {
+	if over, ok := err.(*ThrottledError); ok {
+		return over.Response()
+	}
+	return quotaUnavailableResponse
+}
+
+// limit is what quota allows of its kind of usage
+func (quota Quota) limit() store.UsageLimit {
+	return store.UsageLimit{Limit: quota.Limit, Window: quota.Window}
+}
+
+// checkQuota returns a ThrottledError if using amount more would put
+// phoneNumber over quota, with the time enough usage falls out of the window
+func checkQuota(phoneNumber string, quota Quota, amount float64) error {
+	if DB == nil || quota.Limit == 0 {
+		return nil
+	}
+	now := time.Now()
+	usage, err := DB.UsageSince(phoneNumber, quota.Usage, now.Add(-quota.Window))
+	if err != nil {
+		// rather serve people than lock everyone out on a database error
+		log.Errorf("Could not check %s quota of %s: %s", quota.Name, phoneNumber, err)
+		return nil
+	}
+	if retryAt, over := store.OverLimit(usage, amount, quota.limit(), now); over {
+		return &ThrottledError{Quota: quota, RetryAt: retryAt}
+	}
+	return nil
+}
+
+// chargeQuotas records amount of usage against phoneNumber if it is
+// within every one of quotas, otherwise returns a ThrottledError. The
+// store checks and records in one transaction so replicas sharing it
+// cannot both let through the last of a quota
+func chargeQuotas(phoneNumber string, usage string, amount float64, quotas []Quota) error {
+	if DB == nil {
+		return nil
+	}
+	limits := make([]store.UsageLimit, len(quotas))
+	for i, quota := range quotas {
+		limits[i] = quota.limit()
+	}
+	err := DB.ChargeUsage(phoneNumber, usage, amount, limits, time.Now())
+	if over, ok := err.(*store.LimitError); ok {
+		return &ThrottledError{Quota: quotas[over.Index], RetryAt: over.RetryAt}
+	}
+	return err
+}
+
+// checkRequest returns a ThrottledError if phoneNumber has no requests
+// left, without counting one, so senders over quota are turned away
+// before any work is done for them
+func checkRequest(phoneNumber string) error {
+	for _, quota := range requestQuotas() {
+		if err := checkQuota(phoneNumber, quota, 1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// admitRequest counts a validated request against the request quotas
+// of phoneNumber if it is within them
+func admitRequest(phoneNumber string) error {
+	return chargeQuotas(phoneNumber, store.UsageRequests, 1, requestQuotas())
+}
+
+// checkVideo returns a ThrottledError if phoneNumber has no video left
+// to convert, checked before downloading as a second is the least charged
+func checkVideo(phoneNumber string) error {
+	return checkQuota(phoneNumber, videoQuota(), 1)
+}
+
+// chargeVideo counts the seconds of a video of duration the worker
+// will convert against the video quota of phoneNumber if within it
+func chargeVideo(phoneNumber string, duration float64) error {
+	seconds := math.Max(1, math.Min(duration, utils.MaxClipSeconds))
+	return chargeQuotas(phoneNumber, store.UsageVideoSeconds, seconds, []Quota{videoQuota()})
+}
+
+// PruneUsage forgets usage too old to count against any quota
+func PruneUsage() {
+	if DB == nil {
+		return
+	}
+	if err := DB.PruneUsage(time.Now().Add(-24 * time.Hour)); err != nil {
+		log.Errorf("Could not prune usage: %s", err)
+	}
+}
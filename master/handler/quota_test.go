@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/deven96/whatsticker/master/store"
+)
+
+func useTestStore(t *testing.T) {
+	t.Helper()
+	db, err := store.NewSQLite(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	DB = db
+	t.Cleanup(func() {
+		DB = nil
+		db.Close()
+	})
+}
+
+func TestAdmitRequestIsAtomic(t *testing.T) {
+	useTestStore(t)
+	t.Setenv("QUOTA_REQUESTS_PER_MINUTE", "3")
+	const sender = "2348000000000"
+	seeUser(sender)
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	admitted := 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if admitRequest(sender) == nil {
+				lock.Lock()
+				admitted++
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if admitted != 3 {
+		t.Errorf("admitted %d requests at once, want 3", admitted)
+	}
+	if err := checkRequest(sender); err == nil {
+		t.Error("checkRequest passed over quota")
+	}
+}
+
+func TestChargeVideoChargesClipSeconds(t *testing.T) {
+	useTestStore(t)
+	t.Setenv("QUOTA_VIDEO_SECONDS_PER_DAY", "25")
+	const sender = "2348000000001"
+	seeUser(sender)
+	for _, duration := range []float64{4.5, 60} {
+		if err := chargeVideo(sender, duration); err != nil {
+			t.Fatalf("charging %.1fs: %s", duration, err)
+		}
+	}
+	usage, err := DB.UsageSince(sender, store.UsageVideoSeconds, time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usage) != 2 || usage[0].Amount != 4.5 || usage[1].Amount != 10 {
+		t.Errorf("charged %+v, want 4.5 then 10 seconds", usage)
+	}
+	// 10.5 seconds are left, enough for another clip but not a second more after it
+	if err = chargeVideo(sender, 30); err != nil {
+		t.Errorf("a clip within quota was refused: %s", err)
+	}
+	if err = checkVideo(sender); err == nil {
+		t.Error("half a second left passed the check")
+	}
+	if err = chargeVideo(sender, 0.2); err == nil {
+		t.Error("charged past the video quota")
+	}
+}
@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/deven96/whatsticker/master/store"
+	"github.com/deven96/whatsticker/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// DB : where user settings are kept, nil runs the bot without settings
+var DB store.Store
+
+// supportedLanguages are the languages replies can be given in
+var supportedLanguages = []string{"en", "es", "pt", "fr"}
+
+// seeUser records that phoneNumber messaged the bot, creating the user on first sight
+func seeUser(phoneNumber string) {
+	if DB == nil {
+		return
+	}
+	if _, err := DB.SeeUser(phoneNumber); err != nil {
+		log.Errorf("Could not record user %s: %s", phoneNumber, err)
+	}
+}
+
+// lookupUser returns the settings of phoneNumber, or nil when they cannot be found
+func lookupUser(phoneNumber string) *store.User {
+	if DB == nil {
+		return nil
+	}
+	user, err := DB.GetUser(phoneNumber)
+	if err != nil {
+		if err != store.ErrNotFound {
+			log.Errorf("Could not look up user %s: %s", phoneNumber, err)
+		}
+		return nil
+	}
+	return user
+}
+
+// userDefaults are the options a user's captions are parsed on top of
+func userDefaults(user *store.User) utils.ConvertOptions {
+	if user == nil {
+		return utils.ConvertOptions{}
+	}
+	return utils.ConvertOptions{
+		Fit:        user.FitMode,
+		PackName:   user.PackName,
+		PackAuthor: user.PackAuthor,
+	}
+}
+
+// userLanguage is the language a user chose for replies, empty when unset
+func userLanguage(user *store.User) string {
+	if user == nil {
+		return ""
+	}
+	return user.Language
+}
+
+// Settings shows or changes the defaults applied to a user's stickers
+type Settings struct{}
+
+func (Settings) Name() string      { return "settings" }
+func (Settings) Aliases() []string { return []string{"set"} }
+func (Settings) Usage() string     { return "[language|fit|optout|optin] [value]" }
+func (Settings) Help() string      { return "Shows or changes your defaults e.g /settings fit cover" }
+
+func (Settings) describe(user *store.User) string {
+	orDefault := func(value, fallback string) string {
+		if value == "" {
+			return fallback
+		}
+		return value
+	}
+	optOuts := "nothing"
+	if len(user.OptOuts) > 0 {
+		optOuts = strings.Join(user.OptOuts, ", ")
+	}
+	return strings.Join([]string{
+		"Your settings:",
+		"language: " + orDefault(user.Language, "automatic"),
+		"fit: " + orDefault(user.FitMode, utils.FitContain),
+		"pack: " + orDefault(user.PackName, "default"),
+		"author: " + orDefault(user.PackAuthor, "default"),
+		"opted out of: " + optOuts,
+	}, "\n")
+}
+
+func (s Settings) Run(ctx *CommandContext, args []string) error {
+	user := lookupUser(ctx.Message.From)
+	if user == nil {
+		ctx.Reply("Settings are not available right now, please try again later")
+		return nil
+	}
+	if len(args) == 0 {
+		ctx.Reply(s.describe(user))
+		return nil
+	}
+	if len(args) < 2 {
+		ctx.Reply(fmt.Sprintf("Usage: %s", usage(s)))
+		return nil
+	}
+	value := strings.ToLower(args[1])
+	switch strings.ToLower(args[0]) {
+	case "language", "lang":
+		if value == "auto" {
+			value = ""
+		} else if !contains(supportedLanguages, value) {
+			ctx.Reply(fmt.Sprintf("Language must be auto or one of %s", strings.Join(supportedLanguages, ", ")))
+			return nil
+		}
+		user.Language = value
+	case "fit":
+		if value != utils.FitContain && value != utils.FitCover {
+			ctx.Reply(fmt.Sprintf("Fit must be %s or %s", utils.FitContain, utils.FitCover))
+			return nil
+		}
+		user.FitMode = value
+	case "optout", "optin":
+		if value != store.OptOutHeadsUp && value != store.OptOutHistory {
+			ctx.Reply(fmt.Sprintf("You can opt out of %s or %s", store.OptOutHeadsUp, store.OptOutHistory))
+			return nil
+		}
+		user.OptOuts = remove(user.OptOuts, value)
+		if strings.ToLower(args[0]) == "optout" {
+			user.OptOuts = append(user.OptOuts, value)
+		}
+	default:
+		ctx.Reply(fmt.Sprintf("Unknown setting %s, usage: %s", args[0], usage(s)))
+		return nil
+	}
+	if err := DB.SaveUser(user); err != nil {
+		return err
+	}
+	ctx.Reply(s.describe(user))
+	return nil
+}
+
+// Pack names the sticker pack a user's stickers are saved under
+type Pack struct{}
+
+func (Pack) Name() string      { return "pack" }
+func (Pack) Aliases() []string { return nil }
+func (Pack) Usage() string     { return `"name" ["author"] | reset` }
+func (Pack) Help() string      { return "Names the sticker pack your stickers are saved under" }
+
+func (p Pack) Run(ctx *CommandContext, args []string) error {
+	user := lookupUser(ctx.Message.From)
+	if user == nil {
+		ctx.Reply("Settings are not available right now, please try again later")
+		return nil
+	}
+	switch {
+	case len(args) == 0:
+		ctx.Reply(fmt.Sprintf("Usage: %s", usage(p)))
+		return nil
+	case len(args) == 1 && strings.ToLower(args[0]) == "reset":
+		user.PackName, user.PackAuthor = "", ""
+	default:
+		user.PackName = stringValue("=" + args[0])
+		if len(args) > 1 {
+			user.PackAuthor = stringValue("=" + args[1])
+		}
+	}
+	if err := DB.SaveUser(user); err != nil {
+		return err
+	}
+	if user.PackName == "" {
+		ctx.Reply("Your stickers will be saved under the default pack")
+		return nil
+	}
+	ctx.Reply(fmt.Sprintf("Your stickers will be saved under %s", user.PackName))
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// remove returns values without any value
+func remove(values []string, value string) []string {
+	var kept []string
+	for _, v := range values {
+		if v != value {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+func init() {
+	RegisterCommand(Settings{})
+	RegisterCommand(Pack{})
+}
@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/deven96/whatsticker/master/store"
+)
+
+// Stats tells a user how much they have used the bot
+type Stats struct{}
+
+func (Stats) Name() string      { return "stats" }
+func (Stats) Aliases() []string { return []string{"usage"} }
+func (Stats) Usage() string     { return "" }
+func (Stats) Help() string {
+	return "Shows how many stickers you have made and what is left of your limits"
+}
+
+// usedSince totals what phoneNumber used of kind over the last window
+func usedSince(phoneNumber string, kind string, window time.Duration) (float64, error) {
+	usage, err := DB.UsageSince(phoneNumber, kind, time.Now().Add(-window))
+	if err != nil {
+		return 0, err
+	}
+	total := 0.0
+	for _, u := range usage {
+		total += u.Amount
+	}
+	return total, nil
+}
+
+// describeQuota formats used against the limit of quota, 0 being unlimited
+func describeQuota(used float64, quota Quota) string {
+	if quota.Limit == 0 {
+		return fmt.Sprintf("%s: %g", quota.Reason, math.Ceil(used))
+	}
+	return fmt.Sprintf("%s: %g of %g", quota.Reason, math.Ceil(used), quota.Limit)
+}
+
+func (Stats) Run(ctx *CommandContext, args []string) error {
+	user := lookupUser(ctx.Message.From)
+	if user == nil {
+		ctx.Reply("Stats are not available right now, please try again later")
+		return nil
+	}
+	kept, err := DB.CountStickers(user.PhoneNumber)
+	if err != nil {
+		return err
+	}
+	lines := []string{
+		"Your stats:",
+		"using the bot since " + user.CreatedAt.Format("2006-01-02"),
+		fmt.Sprintf("stickers in your history: %d", kept),
+	}
+	for _, quota := range append(requestQuotas(), videoQuota()) {
+		used, err := usedSince(user.PhoneNumber, quota.Usage, quota.Window)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, describeQuota(used, quota))
+	}
+	if user.OptedOut(store.OptOutHistory) {
+		lines = append(lines, "", "Your stickers are not being kept, send /settings optin history to keep them")
+	}
+	ctx.Reply(strings.Join(lines, "\n"))
+	return nil
+}
+
+func init() {
+	RegisterCommand(Stats{})
+}
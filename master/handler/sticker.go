@@ -0,0 +1,100 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/deven96/whatsticker/master/whatsapp"
+	"github.com/deven96/whatsticker/utils"
+	amqp "github.com/rabbitmq/amqp091-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// PNGFormat is the extension static stickers are extracted to
+const PNGFormat = ".png"
+
+// MP4Format is the extension animated stickers are extracted to
+const MP4Format = ".mp4"
+
+// StickerFileSizeLimit is the largest sticker whatsapp delivers (500KiB)
+const StickerFileSizeLimit = 512000
+
+// Sticker reverses a received sticker back into an image or video
+type Sticker struct {
+	RawPath       string
+	ConvertedPath string
+	Message       *whatsapp.Message
+	PhoneNumberID string
+	MediaURL      string
+	Len           int
+}
+
+func (handler *Sticker) SetUp(message *whatsapp.Message, phoneNumberID string) {
+	handler.Message = message
+	handler.PhoneNumberID = phoneNumberID
+
+	newpath := filepath.Join(".", "stickers/raw")
+	os.MkdirAll(newpath, os.ModePerm)
+	newpath = filepath.Join(".", "stickers/converted")
+	os.MkdirAll(newpath, os.ModePerm)
+}
+
+func (handler *Sticker) Validate() error {
+	if handler == nil {
+		return errors.New("please initialize handler")
+	}
+	meta, err := handler.Message.ContentLength()
+	if err != nil {
+		return err
+	}
+	if meta.FileSize > StickerFileSizeLimit {
+		length := meta.FileSize / 1024
+		replyText(handler.Message, handler.PhoneNumberID, fmt.Sprintf(whatsappErrorResponse, "sticker", length, StickerFileSizeLimit/1024))
+		return errors.New("sticker too large")
+	}
+	handler.MediaURL = meta.URL
+	handler.Len = meta.FileSize
+	return nil
+}
+
+func (handler *Sticker) Handle(ch *amqp.Channel, pushTo *amqp.Queue) error {
+	if handler == nil {
+		return errors.New("no Handler")
+	}
+	message := handler.Message
+	extension := PNGFormat
+	if message.Sticker.Animated {
+		extension = MP4Format
+	}
+	handler.RawPath = fmt.Sprintf("stickers/raw/%s%s", message.MediaID(), WebPFormat)
+	handler.ConvertedPath = fmt.Sprintf("stickers/converted/%s%s", message.MediaID(), extension)
+	timings := utils.Timings{Received: message.ReceivedAt, DownloadStarted: time.Now()}
+	err := message.DownloadMedia(handler.RawPath, handler.MediaURL)
+	if err != nil {
+		log.Errorf("Failed to download sticker: %v\n", err)
+		return err
+	}
+	timings.Downloaded = time.Now()
+	recordDownloaded(message, "sticker")
+	user := lookupUser(message.From)
+	convertTask := &utils.ConvertTask{
+		MediaPath:     handler.RawPath,
+		ConvertedPath: handler.ConvertedPath,
+		DataLen:       handler.Len,
+		MediaType:     "sticker",
+		Animated:      message.Sticker.Animated,
+		MessageID:     message.ID,
+		From:          message.From,
+		PhoneNumberID: handler.PhoneNumberID,
+		IsGroup:       message.IsGroup(),
+		MessageSender: message.From,
+		TimeOfRequest: message.Time(),
+		Language:      userLanguage(user),
+		Timings:       timings,
+	}
+	queueTask(ch, pushTo, convertTask)
+	return nil
+}
@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/deven96/whatsticker/master/whatsapp"
+	"github.com/deven96/whatsticker/utils"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// TextLengthLimit caps the characters rendered onto a text sticker
+// anything longer becomes unreadable at 512x512
+const TextLengthLimit = 120
+
+const textTooLongResponse = "Your text is %d characters, text stickers support at most %d"
+const textEmptyResponse = "Send some text to turn into a sticker"
+
+// Text renders the body of a text message into a sticker
+type Text struct {
+	ConvertedPath string
+	Message       *whatsapp.Message
+	PhoneNumberID string
+	Body          string
+}
+
+func (handler *Text) SetUp(message *whatsapp.Message, phoneNumberID string) {
+	handler.Message = message
+	handler.PhoneNumberID = phoneNumberID
+	handler.Body = strings.TrimSpace(message.Text.Body)
+
+	newpath := filepath.Join(".", "texts/converted")
+	os.MkdirAll(newpath, os.ModePerm)
+}
+
+func (handler *Text) Validate() error {
+	if handler == nil {
+		return errors.New("please initialize handler")
+	}
+	length := utf8.RuneCountInString(handler.Body)
+	if length == 0 {
+		replyText(handler.Message, handler.PhoneNumberID, textEmptyResponse)
+		return errors.New("text is empty")
+	}
+	if length > TextLengthLimit {
+		replyText(handler.Message, handler.PhoneNumberID, fmt.Sprintf(textTooLongResponse, length, TextLengthLimit))
+		return errors.New("text too long")
+	}
+	return nil
+}
+
+func (handler *Text) Handle(ch *amqp.Channel, pushTo *amqp.Queue) error {
+	if handler == nil {
+		return errors.New("no Handler")
+	}
+	message := handler.Message
+	handler.ConvertedPath = fmt.Sprintf("texts/converted/%s%s", message.ID, WebPFormat)
+	user := lookupUser(message.From)
+	convertTask := &utils.ConvertTask{
+		ConvertedPath: handler.ConvertedPath,
+		DataLen:       len(handler.Body),
+		MediaType:     "text",
+		Text:          handler.Body,
+		MessageID:     message.ID,
+		From:          message.From,
+		PhoneNumberID: handler.PhoneNumberID,
+		IsGroup:       message.IsGroup(),
+		MessageSender: message.From,
+		TimeOfRequest: message.Time(),
+		Options:       userDefaults(user),
+		Language:      userLanguage(user),
+		SourceSHA256:  fmt.Sprintf("%x", sha256.Sum256([]byte(handler.Body))),
+		Timings:       utils.Timings{Received: message.ReceivedAt},
+	}
+	queueTask(ch, pushTo, convertTask)
+	return nil
+}
@@ -8,13 +8,14 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/deven96/whatsticker/master/admin"
 	"github.com/deven96/whatsticker/master/handler"
+	"github.com/deven96/whatsticker/master/store"
 	"github.com/deven96/whatsticker/master/task"
 	"github.com/deven96/whatsticker/master/whatsapp"
 	"github.com/deven96/whatsticker/utils"
-
-	_ "github.com/mattn/go-sqlite3"
 	amqp "github.com/rabbitmq/amqp091-go"
 	log "github.com/sirupsen/logrus"
 )
@@ -50,10 +51,21 @@ func liveness(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte(`{"schemaVersion": 1,"label": "whatsticker","message": "alive","color": "green"}`))
 }
 
+// deadLetterTTL is DEAD_LETTER_TTL e.g 72h, how long failed tasks can
+// wait to be requeued, defaulting to a week
+func deadLetterTTL() time.Duration {
+	ttl, err := time.ParseDuration(os.Getenv("DEAD_LETTER_TTL"))
+	if err != nil || ttl <= 0 {
+		return 7 * 24 * time.Hour
+	}
+	return ttl
+}
+
 func main() {
 	masterDir, _ := filepath.Abs("./master")
 	logLevel := flag.String("log-level", "INFO", "Set log level to one of (INFO/DEBUG)")
 	port := flag.String("port", "9000", "Set port to start incoming streaming server")
+	adminPort := flag.String("admin-port", "9001", "Set port to start the admin API on, it only starts when ADMIN_TOKEN is set")
 	flag.Parse()
 
 	if ll := os.Getenv("LOG_LEVEL"); ll != "" {
@@ -64,6 +76,22 @@ func main() {
 	log.SetLevel(utils.GetLogLevel(*logLevel))
 	fmt.Println(masterDir)
 
+	databasePath := os.Getenv("DATABASE_PATH")
+	if databasePath == "" {
+		databasePath = filepath.Join(masterDir, "db", "whatsticker.db")
+	}
+	db, err := store.NewSQLite(databasePath)
+	utils.FailOnError(err, "Failed to open database")
+	defer db.Close()
+	utils.FailOnError(db.Migrate(), "Failed to migrate database")
+	handler.DB = db
+	utils.UseFeatureSource(db)
+	go func() {
+		for range time.Tick(time.Hour) {
+			handler.PruneUsage()
+		}
+	}()
+
 	amqpConfig := utils.GetAMQPConfig()
 	conn, err := amqp.Dial(amqpConfig.Uri)
 	utils.FailOnError(err, "Failed to connect to RabbitMQ")
@@ -84,8 +112,29 @@ func main() {
 	convertQueue = utils.GetQueue(ch, os.Getenv("CONVERT_TO_WEBP_QUEUE"), true)
 	completeQueue := utils.GetQueue(ch, os.Getenv("SEND_WEBP_TO_WHATSAPP_QUEUE"), true)
 	loggingQueue = utils.GetQueue(ch, os.Getenv("LOG_METRIC_QUEUE"), false)
+	failedQueue := utils.GetQueue(ch, os.Getenv("FAILED_TASK_QUEUE"), true)
+	var stateQueue *amqp.Queue
+	if name := os.Getenv("TASK_STATE_QUEUE"); name != "" {
+		stateQueue = utils.GetQueue(ch, name, true)
+	}
+	var deadLetterQueue, expiredQueue *amqp.Queue
+	if name := os.Getenv("DEAD_LETTER_QUEUE"); name != "" {
+		// dead letters expire onto a queue whose consumer removes their media
+		expiredQueue = utils.GetQueue(ch, name+".expired", true)
+		deadLetterQueue = utils.GetQueueWithArgs(ch, name, true, amqp.Table{
+			"x-message-ttl":             deadLetterTTL().Milliseconds(),
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": expiredQueue.Name,
+		})
+	}
 	complete := &task.StickerConsumer{
 		PushMetricsTo: loggingQueue,
+		Store:         db,
+	}
+	failed := &task.FailureConsumer{
+		PushMetricsTo: loggingQueue,
+		DeadLetterTo:  deadLetterQueue,
+		Store:         db,
 	}
 
 	completeQueueMsgs, err := ch.Consume(
@@ -103,6 +152,90 @@ func main() {
 			complete.Execute(ch, &d)
 		}
 	}()
+
+	failedQueueMsgs, err := ch.Consume(
+		failedQueue.Name, // queue
+		"",               // consumer
+		false,            // auto-ack, so we can ack it ourself after processing
+		false,            // exclusive
+		false,            // no-local
+		false,            // no-wait
+		nil,              // args
+	)
+	utils.FailOnError(err, "Failed to register a consumer")
+	go func() {
+		for d := range failedQueueMsgs {
+			failed.Execute(ch, &d)
+		}
+	}()
+
+	if token := os.Getenv("ADMIN_TOKEN"); token != "" {
+		adminCh, err := conn.Channel()
+		utils.FailOnError(err, "Failed to open a channel")
+		defer adminCh.Close()
+		queues := []string{convertQueue.Name, completeQueue.Name, failedQueue.Name, loggingQueue.Name}
+		if stateQueue != nil {
+			queues = append(queues, stateQueue.Name)
+		}
+		if deadLetterQueue != nil {
+			queues = append(queues, deadLetterQueue.Name)
+		}
+		server := &admin.Server{
+			Token:        token,
+			Channel:      adminCh,
+			Queues:       queues,
+			ConvertQueue: convertQueue,
+			DeadLetters:  deadLetterQueue,
+			Store:        db,
+		}
+		go func() {
+			log.Infof("Starting admin API on %s", *adminPort)
+			if err := http.ListenAndServe(":"+*adminPort, server.Handler()); err != nil {
+				log.Errorf("Could not start admin API on %s: %s", *adminPort, err)
+			}
+		}()
+	} else {
+		log.Info("ADMIN_TOKEN is not set, not starting the admin API")
+	}
+
+	if expiredQueue != nil {
+		expired := &task.ExpiredConsumer{}
+		expiredQueueMsgs, err := ch.Consume(
+			expiredQueue.Name, // queue
+			"",                // consumer
+			false,             // auto-ack, so we can ack it ourself after processing
+			false,             // exclusive
+			false,             // no-local
+			false,             // no-wait
+			nil,               // args
+		)
+		utils.FailOnError(err, "Failed to register a consumer")
+		go func() {
+			for d := range expiredQueueMsgs {
+				expired.Execute(ch, &d)
+			}
+		}()
+	}
+
+	if stateQueue != nil {
+		states := &task.StateConsumer{Store: db}
+		stateQueueMsgs, err := ch.Consume(
+			stateQueue.Name, // queue
+			"",              // consumer
+			false,           // auto-ack, so we can ack it ourself after processing
+			false,           // exclusive
+			false,           // no-local
+			false,           // no-wait
+			nil,             // args
+		)
+		utils.FailOnError(err, "Failed to register a consumer")
+		go func() {
+			for d := range stateQueueMsgs {
+				states.Execute(ch, &d)
+			}
+		}()
+	}
+
 	http.Handle("/incoming", &incomingMessageHandler{})
 	http.Handle("/", http.HandlerFunc(liveness))
 	if err := http.ListenAndServe(":"+*port, nil); err != nil {
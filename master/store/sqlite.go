@@ -0,0 +1,507 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/deven96/whatsticker/utils"
+	_ "github.com/mattn/go-sqlite3"
+	log "github.com/sirupsen/logrus"
+)
+
+// migrations are applied in order, each exactly once. Append new
+// migrations, never edit ones which may have been applied already
+var migrations = []string{
+	`CREATE TABLE users (
+		phone_number TEXT PRIMARY KEY,
+		language TEXT NOT NULL DEFAULT '',
+		fit_mode TEXT NOT NULL DEFAULT 'contain',
+		pack_name TEXT NOT NULL DEFAULT '',
+		pack_author TEXT NOT NULL DEFAULT '',
+		opt_outs TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL,
+		last_seen TIMESTAMP NOT NULL
+	)`,
+	`CREATE TABLE stickers (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		phone_number TEXT NOT NULL REFERENCES users (phone_number),
+		source_sha256 TEXT NOT NULL,
+		storage_key TEXT NOT NULL,
+		media_type TEXT NOT NULL,
+		options TEXT NOT NULL DEFAULT '{}',
+		media_id TEXT NOT NULL DEFAULT '',
+		uploaded_at TIMESTAMP NOT NULL,
+		created_at TIMESTAMP NOT NULL
+	)`,
+	`CREATE INDEX stickers_phone_number ON stickers (phone_number, created_at)`,
+	`CREATE TABLE usage (
+		phone_number TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		amount REAL NOT NULL,
+		at TIMESTAMP NOT NULL
+	)`,
+	`CREATE INDEX usage_phone_number_kind ON usage (phone_number, kind, at)`,
+	`CREATE TABLE access_rules (
+		pattern TEXT NOT NULL,
+		prefix BOOLEAN NOT NULL,
+		action TEXT NOT NULL,
+		note TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL,
+		PRIMARY KEY (pattern, prefix)
+	)`,
+	`CREATE TABLE tasks (
+		message_id TEXT PRIMARY KEY,
+		phone_number TEXT NOT NULL,
+		media_type TEXT NOT NULL,
+		state TEXT NOT NULL,
+		detail TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	)`,
+	`CREATE INDEX tasks_updated_at ON tasks (updated_at)`,
+	`ALTER TABLE tasks ADD COLUMN reply_id TEXT NOT NULL DEFAULT ''`,
+	`CREATE INDEX tasks_reply_id ON tasks (reply_id)`,
+	`CREATE TABLE task_transitions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		message_id TEXT NOT NULL,
+		state TEXT NOT NULL,
+		detail TEXT NOT NULL DEFAULT '',
+		at TIMESTAMP NOT NULL
+	)`,
+	`CREATE INDEX task_transitions_message_id ON task_transitions (message_id, at)`,
+	`CREATE TABLE feature_flags (
+		name TEXT PRIMARY KEY,
+		enabled BOOLEAN NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	)`,
+}
+
+// SQLite : Store backed by a SQLite database file
+type SQLite struct {
+	db *sql.DB
+}
+
+// NewSQLite opens (creating if need be) the database at path
+func NewSQLite(path string) (*SQLite, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	// sqlite allows a single writer, serialise access rather than fail with SQLITE_BUSY
+	db, err := sql.Open("sqlite3", path+"?_busy_timeout=5000&_foreign_keys=on")
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	return &SQLite{db: db}, nil
+}
+
+// Migrate : applies the migrations the database has not seen yet. Replicas
+// starting together take turns, each seeing what the one before applied
+func (s *SQLite) Migrate() error {
+	return s.immediate(func(ctx context.Context, conn *sql.Conn) error {
+		_, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (version INTEGER PRIMARY KEY)`)
+		if err != nil {
+			return err
+		}
+		var version int
+		err = conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+		if err != nil {
+			return err
+		}
+		for i := version; i < len(migrations); i++ {
+			log.Infof("Applying migration %d", i+1)
+			if _, err = conn.ExecContext(ctx, migrations[i]); err != nil {
+				return err
+			}
+			if _, err = conn.ExecContext(ctx, `INSERT INTO schema_migrations (version) VALUES (?)`, i+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// immediate runs fn in a transaction holding the write lock of the
+// database from the start, so what fn reads cannot change before it
+// writes, even from other processes sharing the file
+func (s *SQLite) immediate(fn func(ctx context.Context, conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err = conn.ExecContext(ctx, `BEGIN IMMEDIATE`); err != nil {
+		return err
+	}
+	if err = fn(ctx, conn); err == nil {
+		_, err = conn.ExecContext(ctx, `COMMIT`)
+	}
+	if err != nil {
+		conn.ExecContext(ctx, `ROLLBACK`)
+	}
+	return err
+}
+
+const userColumns = `phone_number, language, fit_mode, pack_name, pack_author, opt_outs, created_at, last_seen`
+
+func scanUser(row *sql.Row) (*User, error) {
+	var user User
+	var optOuts string
+	err := row.Scan(&user.PhoneNumber, &user.Language, &user.FitMode, &user.PackName,
+		&user.PackAuthor, &optOuts, &user.CreatedAt, &user.LastSeen)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if optOuts != "" {
+		user.OptOuts = strings.Split(optOuts, ",")
+	}
+	return &user, nil
+}
+
+func (s *SQLite) GetUser(phoneNumber string) (*User, error) {
+	return scanUser(s.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE phone_number = ?`, phoneNumber))
+}
+
+func (s *SQLite) SeeUser(phoneNumber string) (*User, error) {
+	now := time.Now().UTC()
+	_, err := s.db.Exec(`INSERT INTO users (phone_number, fit_mode, created_at, last_seen) VALUES (?, ?, ?, ?)
+		ON CONFLICT (phone_number) DO UPDATE SET last_seen = excluded.last_seen`,
+		phoneNumber, utils.FitContain, now, now)
+	if err != nil {
+		return nil, err
+	}
+	return s.GetUser(phoneNumber)
+}
+
+func (s *SQLite) SaveUser(user *User) error {
+	result, err := s.db.Exec(`UPDATE users SET language = ?, fit_mode = ?, pack_name = ?, pack_author = ?, opt_outs = ?
+		WHERE phone_number = ?`,
+		user.Language, user.FitMode, user.PackName, user.PackAuthor, strings.Join(user.OptOuts, ","), user.PhoneNumber)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLite) AddSticker(sticker *Sticker) error {
+	if sticker.CreatedAt.IsZero() {
+		sticker.CreatedAt = time.Now().UTC()
+	}
+	result, err := s.db.Exec(`INSERT INTO stickers (phone_number, source_sha256, storage_key, media_type, options, media_id, uploaded_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		sticker.PhoneNumber, sticker.SourceSHA256, sticker.StorageKey, sticker.MediaType, sticker.Options,
+		sticker.MediaID, sticker.UploadedAt, sticker.CreatedAt)
+	if err != nil {
+		return err
+	}
+	sticker.ID, err = result.LastInsertId()
+	return err
+}
+
+func (s *SQLite) RecentStickers(phoneNumber string, limit int) ([]Sticker, error) {
+	rows, err := s.db.Query(`SELECT id, phone_number, source_sha256, storage_key, media_type, options, media_id, uploaded_at, created_at
+		FROM stickers WHERE phone_number = ? ORDER BY created_at DESC, id DESC LIMIT ?`, phoneNumber, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var stickers []Sticker
+	for rows.Next() {
+		var sticker Sticker
+		err = rows.Scan(&sticker.ID, &sticker.PhoneNumber, &sticker.SourceSHA256, &sticker.StorageKey, &sticker.MediaType,
+			&sticker.Options, &sticker.MediaID, &sticker.UploadedAt, &sticker.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		stickers = append(stickers, sticker)
+	}
+	return stickers, rows.Err()
+}
+
+func (s *SQLite) SetStickerMedia(id int64, mediaID string, uploadedAt time.Time) error {
+	result, err := s.db.Exec(`UPDATE stickers SET media_id = ?, uploaded_at = ? WHERE id = ?`, mediaID, uploadedAt, id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLite) CountStickers(phoneNumber string) (int, error) {
+	var count int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM stickers WHERE phone_number = ?`, phoneNumber).Scan(&count)
+	return count, err
+}
+
+func (s *SQLite) DeleteSticker(id int64) error {
+	result, err := s.db.Exec(`DELETE FROM stickers WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLite) ChargeUsage(phoneNumber string, kind string, amount float64, limits []UsageLimit, at time.Time) error {
+	return s.immediate(func(ctx context.Context, conn *sql.Conn) error {
+		for i, limit := range limits {
+			usage, err := usageSince(ctx, conn, phoneNumber, kind, at.Add(-limit.Window))
+			if err != nil {
+				return err
+			}
+			if retryAt, over := OverLimit(usage, amount, limit, at); over {
+				return &LimitError{Index: i, RetryAt: retryAt}
+			}
+		}
+		_, err := conn.ExecContext(ctx, `INSERT INTO usage (phone_number, kind, amount, at) VALUES (?, ?, ?, ?)`,
+			phoneNumber, kind, amount, at.UTC())
+		return err
+	})
+}
+
+func (s *SQLite) UsageSince(phoneNumber string, kind string, since time.Time) ([]Usage, error) {
+	return usageSince(context.Background(), s.db, phoneNumber, kind, since)
+}
+
+// queryer is what *sql.DB and *sql.Conn share for reads
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func usageSince(ctx context.Context, q queryer, phoneNumber string, kind string, since time.Time) ([]Usage, error) {
+	rows, err := q.QueryContext(ctx, `SELECT amount, at FROM usage WHERE phone_number = ? AND kind = ? AND at > ? ORDER BY at`,
+		phoneNumber, kind, since.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var usage []Usage
+	for rows.Next() {
+		var u Usage
+		if err = rows.Scan(&u.Amount, &u.At); err != nil {
+			return nil, err
+		}
+		usage = append(usage, u)
+	}
+	return usage, rows.Err()
+}
+
+func (s *SQLite) PruneUsage(before time.Time) error {
+	_, err := s.db.Exec(`DELETE FROM usage WHERE at < ?`, before.UTC())
+	return err
+}
+
+func (s *SQLite) AccessRules() ([]AccessRule, error) {
+	rows, err := s.db.Query(`SELECT pattern, prefix, action, note, created_at FROM access_rules ORDER BY pattern`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var rules []AccessRule
+	for rows.Next() {
+		var rule AccessRule
+		if err = rows.Scan(&rule.Pattern, &rule.Prefix, &rule.Action, &rule.Note, &rule.CreatedAt); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+func (s *SQLite) SaveAccessRule(rule *AccessRule) error {
+	if rule.CreatedAt.IsZero() {
+		rule.CreatedAt = time.Now().UTC()
+	}
+	_, err := s.db.Exec(`INSERT INTO access_rules (pattern, prefix, action, note, created_at) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (pattern, prefix) DO UPDATE SET action = excluded.action, note = excluded.note, created_at = excluded.created_at`,
+		rule.Pattern, rule.Prefix, rule.Action, rule.Note, rule.CreatedAt)
+	return err
+}
+
+func (s *SQLite) DeleteAccessRule(pattern string, prefix bool) error {
+	result, err := s.db.Exec(`DELETE FROM access_rules WHERE pattern = ? AND prefix = ?`, pattern, prefix)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *SQLite) SetTaskState(task *Task) error {
+	if task.UpdatedAt.IsZero() {
+		task.UpdatedAt = time.Now().UTC()
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var current utils.TaskState
+	err = tx.QueryRow(`SELECT state FROM tasks WHERE message_id = ?`, task.MessageID).Scan(&current)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO task_transitions (message_id, state, detail, at) VALUES (?, ?, ?, ?)`,
+		task.MessageID, task.State, task.Detail, task.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	if current == "" {
+		task.CreatedAt = task.UpdatedAt
+		_, err = tx.Exec(`INSERT INTO tasks (message_id, phone_number, media_type, state, detail, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			task.MessageID, task.PhoneNumber, task.MediaType, task.State, task.Detail, task.CreatedAt, task.UpdatedAt)
+	} else {
+		// the media type is only known for sure once the media is sniffed
+		if task.MediaType != "" {
+			_, err = tx.Exec(`UPDATE tasks SET media_type = ? WHERE message_id = ?`, task.MediaType, task.MessageID)
+		}
+		if err == nil && CanTransition(current, task.State) {
+			_, err = tx.Exec(`UPDATE tasks SET state = ?, detail = ?, updated_at = ? WHERE message_id = ?`,
+				task.State, task.Detail, task.UpdatedAt, task.MessageID)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLite) SetTaskReply(messageID string, replyID string) error {
+	result, err := s.db.Exec(`UPDATE tasks SET reply_id = ? WHERE message_id = ?`, replyID, messageID)
+	if err != nil {
+		return err
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+const taskColumns = `message_id, phone_number, media_type, state, detail, reply_id, created_at, updated_at`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanTask(row rowScanner) (*Task, error) {
+	var task Task
+	err := row.Scan(&task.MessageID, &task.PhoneNumber, &task.MediaType, &task.State, &task.Detail,
+		&task.ReplyID, &task.CreatedAt, &task.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+func (s *SQLite) GetTask(messageID string) (*Task, error) {
+	return scanTask(s.db.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE message_id = ?`, messageID))
+}
+
+func (s *SQLite) TaskByReply(replyID string) (*Task, error) {
+	return scanTask(s.db.QueryRow(`SELECT `+taskColumns+` FROM tasks WHERE reply_id = ?`, replyID))
+}
+
+func (s *SQLite) TaskTransitions(messageID string) ([]Transition, error) {
+	rows, err := s.db.Query(`SELECT state, detail, at FROM task_transitions WHERE message_id = ? ORDER BY at, id`, messageID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var transitions []Transition
+	for rows.Next() {
+		var transition Transition
+		if err = rows.Scan(&transition.State, &transition.Detail, &transition.At); err != nil {
+			return nil, err
+		}
+		transitions = append(transitions, transition)
+	}
+	return transitions, rows.Err()
+}
+
+func (s *SQLite) RecentTransitions(limit int) (map[string][]Transition, error) {
+	rows, err := s.db.Query(`SELECT t.message_id, t.state, t.detail, t.at FROM task_transitions t
+		JOIN (SELECT message_id FROM tasks ORDER BY updated_at DESC LIMIT ?) recent ON recent.message_id = t.message_id
+		ORDER BY t.at, t.id`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	transitions := map[string][]Transition{}
+	for rows.Next() {
+		var messageID string
+		var transition Transition
+		if err = rows.Scan(&messageID, &transition.State, &transition.Detail, &transition.At); err != nil {
+			return nil, err
+		}
+		transitions[messageID] = append(transitions[messageID], transition)
+	}
+	return transitions, rows.Err()
+}
+
+func (s *SQLite) RecentTasks(limit int) ([]Task, error) {
+	rows, err := s.db.Query(`SELECT `+taskColumns+` FROM tasks ORDER BY updated_at DESC LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tasks []Task
+	for rows.Next() {
+		task, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, *task)
+	}
+	return tasks, rows.Err()
+}
+
+func (s *SQLite) FeatureFlags() (map[string]bool, error) {
+	rows, err := s.db.Query(`SELECT name, enabled FROM feature_flags`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	flags := map[string]bool{}
+	for rows.Next() {
+		var name string
+		var enabled bool
+		if err = rows.Scan(&name, &enabled); err != nil {
+			return nil, err
+		}
+		flags[name] = enabled
+	}
+	return flags, rows.Err()
+}
+
+func (s *SQLite) SetFeatureFlag(name string, enabled bool) error {
+	_, err := s.db.Exec(`INSERT INTO feature_flags (name, enabled, updated_at) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET enabled = excluded.enabled, updated_at = excluded.updated_at`,
+		name, enabled, time.Now().UTC())
+	return err
+}
+
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
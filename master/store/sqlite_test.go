@@ -0,0 +1,158 @@
+package store
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/deven96/whatsticker/utils"
+)
+
+func openTestStore(t *testing.T) *SQLite {
+	t.Helper()
+	s, err := NewSQLite(filepath.Join(t.TempDir(), "db", "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestDeleteSticker(t *testing.T) {
+	s := openTestStore(t)
+	if _, err := s.SeeUser("2348000000000"); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a.webp", "b.webp"} {
+		if err := s.AddSticker(&Sticker{PhoneNumber: "2348000000000", StorageKey: key, MediaType: "image"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if count, err := s.CountStickers("2348000000000"); err != nil || count != 2 {
+		t.Fatalf("counted %d stickers, %v", count, err)
+	}
+	latest, err := s.RecentStickers("2348000000000", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.DeleteSticker(latest[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err = s.DeleteSticker(latest[0].ID); err != ErrNotFound {
+		t.Errorf("deleting twice returned %v", err)
+	}
+	left, err := s.RecentStickers("2348000000000", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 1 || left[0].StorageKey != "a.webp" {
+		t.Errorf("left with %+v", left)
+	}
+}
+
+func TestSetTaskState(t *testing.T) {
+	s := openTestStore(t)
+	start := time.Now().UTC().Add(-time.Minute)
+	record := func(messageID string, mediaType string, state utils.TaskState, after time.Duration) {
+		t.Helper()
+		task := &Task{MessageID: messageID, PhoneNumber: "2348000000000", MediaType: mediaType, State: state, UpdatedAt: start.Add(after)}
+		if err := s.SetTaskState(task); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a gif link arrives as text, the worker reports converting before the master's queued
+	record("link", "text", utils.TaskReceived, 0)
+	record("link", "gif", utils.TaskDownloaded, time.Second)
+	record("link", "gif", utils.TaskConverting, 3*time.Second)
+	record("link", "gif", utils.TaskQueued, 2*time.Second)
+	record("other", "image", utils.TaskReceived, 4*time.Second)
+
+	task, err := s.GetTask("link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.MediaType != "gif" || task.State != utils.TaskConverting {
+		t.Errorf("task is a %s %s, want a gif converting", task.MediaType, task.State)
+	}
+	recent, err := s.RecentTransitions(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recent) != 2 || len(recent["link"]) != 4 || len(recent["other"]) != 1 {
+		t.Fatalf("recent transitions %+v", recent)
+	}
+	if recent["link"][2].State != utils.TaskQueued {
+		t.Errorf("transitions are not in time order: %+v", recent["link"])
+	}
+	if recent, err = s.RecentTransitions(1); err != nil || len(recent) != 1 || recent["other"] == nil {
+		t.Errorf("limited to the latest task got %+v, %v", recent, err)
+	}
+}
+
+func TestMigrateConcurrently(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			s, err := NewSQLite(path)
+			if err == nil {
+				err = s.Migrate()
+				s.Close()
+			}
+			errs <- err
+		}()
+	}
+	for i := 0; i < 3; i++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("replica failed to migrate: %s", err)
+		}
+	}
+	s := openTestStore(t)
+	var applied int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&applied); err != nil {
+		t.Fatal(err)
+	}
+	if applied != len(migrations) {
+		t.Errorf("applied %d migrations, want %d", applied, len(migrations))
+	}
+}
+
+func TestChargeUsageAcrossReplicas(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.db")
+	var replicas []*SQLite
+	for i := 0; i < 3; i++ {
+		s, err := NewSQLite(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = s.Migrate(); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { s.Close() })
+		replicas = append(replicas, s)
+	}
+	limits := []UsageLimit{{Limit: 10, Window: time.Hour}, {Limit: 4, Window: time.Minute}}
+	results := make(chan error, 12)
+	for i := 0; i < 12; i++ {
+		go func(s *SQLite) {
+			results <- s.ChargeUsage("2348000000000", UsageRequests, 1, limits, time.Now())
+		}(replicas[i%len(replicas)])
+	}
+	charged := 0
+	for i := 0; i < 12; i++ {
+		err := <-results
+		if err == nil {
+			charged++
+			continue
+		}
+		if over, ok := err.(*LimitError); !ok || over.Index != 1 {
+			t.Errorf("charge failed with %v, want the per minute limit", err)
+		}
+	}
+	if charged != 4 {
+		t.Errorf("charged %d times, want 4", charged)
+	}
+}
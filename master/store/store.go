@@ -0,0 +1,202 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Things users can opt out of
+const (
+	OptOutHeadsUp = "headsup" // "this might take a while" replies for videos
+	OptOutHistory = "history" // recording the stickers they make
+)
+
+// ErrNotFound is returned when a record does not exist
+var ErrNotFound = errors.New("not found")
+
+// User : a sender and their settings
+type User struct {
+	PhoneNumber string
+	Language    string // empty to guess from the phone number
+	FitMode     string // utils.FitContain or utils.FitCover
+	PackName    string // empty for the default pack name
+	PackAuthor  string
+	OptOuts     []string
+	CreatedAt   time.Time
+	LastSeen    time.Time
+}
+
+// OptedOut : reports whether the user opted out of what
+func (u *User) OptedOut(what string) bool {
+	for _, optOut := range u.OptOuts {
+		if optOut == what {
+			return true
+		}
+	}
+	return false
+}
+
+// Sticker : a sticker made for a user, kept so it can be sent again
+type Sticker struct {
+	ID           int64
+	PhoneNumber  string
+	SourceSHA256 string
+	StorageKey   string // where the sticker is kept, see StickerPath
+	MediaType    string
+	Options      string    // json encoded utils.ConvertOptions
+	MediaID      string    // graph media id from the last upload
+	UploadedAt   time.Time // graph media ids expire 30 days after upload
+	CreatedAt    time.Time
+}
+
+// Kinds of usage counted against quotas
+const (
+	UsageRequests     = "requests"      // stickerization requests
+	UsageVideoSeconds = "video_seconds" // seconds of video and gif converted
+)
+
+// Usage : amount of something a user used at a point in time
+type Usage struct {
+	Amount float64
+	At     time.Time
+}
+
+// UsageLimit : the most of a kind of usage allowed within a window, 0 being unlimited
+type UsageLimit struct {
+	Limit  float64
+	Window time.Duration
+}
+
+// LimitError : charging usage would go over the limit at Index of those
+// it was charged against until RetryAt
+type LimitError struct {
+	Index   int
+	RetryAt time.Time
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("over usage limit %d until %s", e.Index, e.RetryAt.Format(time.RFC3339))
+}
+
+// OverLimit reports whether amount more on top of usage, what was used
+// in the window of limit up to now oldest first, goes over limit and if
+// so when enough of usage leaves the window
+func OverLimit(usage []Usage, amount float64, limit UsageLimit, now time.Time) (time.Time, bool) {
+	if limit.Limit == 0 {
+		return time.Time{}, false
+	}
+	total := amount
+	for _, u := range usage {
+		total += u.Amount
+	}
+	if total <= limit.Limit {
+		return time.Time{}, false
+	}
+	for _, u := range usage {
+		total -= u.Amount
+		if total <= limit.Limit {
+			return u.At.Add(limit.Window), true
+		}
+	}
+	return now.Add(limit.Window), true
+}
+
+// Access rule actions
+const (
+	AccessAllow = "allow"
+	AccessBlock = "block"
+)
+
+// AccessRule : allows or blocks a phone number, or every number
+// starting with a prefix such as a country code
+type AccessRule struct {
+	Pattern   string // digits only, without the leading +
+	Prefix    bool   // match numbers starting with Pattern rather than only Pattern
+	Action    string // AccessAllow or AccessBlock
+	Note      string // why the rule was added
+	CreatedAt time.Time
+}
+
+// Matches : reports whether the rule applies to phoneNumber
+func (r AccessRule) Matches(phoneNumber string) bool {
+	if r.Prefix {
+		return strings.HasPrefix(phoneNumber, r.Pattern)
+	}
+	return phoneNumber == r.Pattern
+}
+
+// Store persists what the bot knows about its users. It is implemented
+// on SQLite, the interface leaves room for a Postgres implementation
+type Store interface {
+	// Migrate brings the schema up to date
+	Migrate() error
+	// SeeUser returns the user with phoneNumber, creating them on first
+	// sight, and records that they were just seen
+	SeeUser(phoneNumber string) (*User, error)
+	// GetUser returns the user with phoneNumber or ErrNotFound
+	GetUser(phoneNumber string) (*User, error)
+	// SaveUser updates the settings of an existing user
+	SaveUser(user *User) error
+	// AddSticker records a sticker made for a user, setting its ID
+	AddSticker(sticker *Sticker) error
+	// RecentStickers returns up to limit of a user's stickers, newest first
+	RecentStickers(phoneNumber string, limit int) ([]Sticker, error)
+	// SetStickerMedia records that a sticker was uploaded again as mediaID
+	SetStickerMedia(id int64, mediaID string, uploadedAt time.Time) error
+	// CountStickers returns how many stickers a user has kept
+	CountStickers(phoneNumber string) (int, error)
+	// DeleteSticker forgets a sticker or returns ErrNotFound
+	DeleteSticker(id int64) error
+	// ChargeUsage adds amount of kind to what a user used at at unless it
+	// goes over any of limits, returning a LimitError if it does. Checking
+	// and adding happen as one step, even across processes
+	ChargeUsage(phoneNumber string, kind string, amount float64, limits []UsageLimit, at time.Time) error
+	// UsageSince returns what a user used of kind since since, oldest first
+	UsageSince(phoneNumber string, kind string, since time.Time) ([]Usage, error)
+	// PruneUsage forgets usage from before before
+	PruneUsage(before time.Time) error
+	// AccessRules returns every access rule
+	AccessRules() ([]AccessRule, error)
+	// SaveAccessRule adds a rule, replacing any rule with the same pattern
+	SaveAccessRule(rule *AccessRule) error
+	// DeleteAccessRule removes the rule for pattern or returns ErrNotFound
+	DeleteAccessRule(pattern string, prefix bool) error
+	// SetTaskState records the transition of a task to task.State at
+	// task.UpdatedAt, creating the task if need be. Transitions are all
+	// kept but only those CanTransition allows change the current state,
+	// since events from the master and worker can arrive out of order.
+	// A non empty task.MediaType replaces the one recorded
+	SetTaskState(task *Task) error
+	// SetTaskReply records the id of the message a task was answered with
+	SetTaskReply(messageID string, replyID string) error
+	// GetTask returns the task for messageID or ErrNotFound
+	GetTask(messageID string) (*Task, error)
+	// TaskByReply returns the task answered with replyID or ErrNotFound
+	TaskByReply(replyID string) (*Task, error)
+	// TaskTransitions returns the transitions of a task, oldest first
+	TaskTransitions(messageID string) ([]Transition, error)
+	// RecentTasks returns up to limit tasks, most recently updated first
+	RecentTasks(limit int) ([]Task, error)
+	// RecentTransitions returns the transitions of up to limit of the most
+	// recently updated tasks, oldest first, keyed by message id
+	RecentTransitions(limit int) (map[string][]Transition, error)
+	// FeatureFlags returns every feature flag toggled at runtime
+	FeatureFlags() (map[string]bool, error)
+	// SetFeatureFlag toggles a feature flag for every replica
+	SetFeatureFlag(name string, enabled bool) error
+	Close() error
+}
+
+// StickerPath : where the sticker with storageKey is kept, under
+// STICKER_HISTORY_DIR (default ./history)
+func StickerPath(storageKey string) string {
+	dir := os.Getenv("STICKER_HISTORY_DIR")
+	if dir == "" {
+		dir = "history"
+	}
+	return filepath.Join(dir, filepath.FromSlash(storageKey))
+}
@@ -0,0 +1,99 @@
+package store
+
+import (
+	"time"
+
+	"github.com/deven96/whatsticker/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// Task : where a stickerization request got to
+type Task struct {
+	MessageID   string
+	PhoneNumber string
+	MediaType   string
+	State       utils.TaskState
+	Detail      string // why the task failed
+	ReplyID     string // id of the message the sticker was sent in, to match delivery receipts
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// Transition : a task reaching a state
+type Transition struct {
+	State  utils.TaskState
+	At     time.Time
+	Detail string
+}
+
+// taskOrder ranks the states a task moves through, failed is left out
+// since a task can fail from any state before it is sent
+var taskOrder = map[utils.TaskState]int{
+	utils.TaskReceived:   1,
+	utils.TaskDownloaded: 2,
+	utils.TaskQueued:     3,
+	utils.TaskConverting: 4,
+	utils.TaskConverted:  5,
+	utils.TaskUploaded:   6,
+	utils.TaskSent:       7,
+	utils.TaskDelivered:  8,
+}
+
+// CanTransition : reports whether a task in state from can move to
+// state to. Tasks only move forwards, states may be skipped (text is
+// never downloaded) and failed tasks can only be queued again
+func CanTransition(from utils.TaskState, to utils.TaskState) bool {
+	switch {
+	case from == "":
+		return true
+	case from == utils.TaskFailed:
+		return to == utils.TaskQueued
+	case to == utils.TaskFailed:
+		return taskOrder[from] < taskOrder[utils.TaskSent]
+	}
+	return taskOrder[to] > taskOrder[from]
+}
+
+// Stage : time a task spent getting from one state to the next
+type Stage struct {
+	From     utils.TaskState
+	To       utils.TaskState
+	Duration time.Duration
+}
+
+// Stages : the time between consecutive transitions, in order
+func Stages(transitions []Transition) []Stage {
+	var stages []Stage
+	for i := 1; i < len(transitions); i++ {
+		stages = append(stages, Stage{
+			From:     transitions[i-1].State,
+			To:       transitions[i].State,
+			Duration: transitions[i].At.Sub(transitions[i-1].At),
+		})
+	}
+	return stages
+}
+
+// RecordTask : moves the task made from convertTask to state on s,
+// logging rather than failing the task when it cannot be recorded
+func RecordTask(s Store, convertTask utils.ConvertTask, state utils.TaskState, detail string) {
+	RecordTaskAt(s, convertTask.MessageID, convertTask.From, convertTask.MediaType, state, detail, time.Now())
+}
+
+// RecordTaskAt : moves the task for messageID to state as of at on s
+func RecordTaskAt(s Store, messageID string, from string, mediaType string, state utils.TaskState, detail string, at time.Time) {
+	if s == nil || messageID == "" {
+		return
+	}
+	task := &Task{
+		MessageID:   messageID,
+		PhoneNumber: from,
+		MediaType:   mediaType,
+		State:       state,
+		Detail:      detail,
+		UpdatedAt:   at.UTC(),
+	}
+	if err := s.SetTaskState(task); err != nil {
+		log.Errorf("Could not record %s as %s: %s", messageID, state, err)
+	}
+}
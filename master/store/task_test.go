@@ -0,0 +1,68 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/deven96/whatsticker/utils"
+)
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to utils.TaskState
+		want     bool
+	}{
+		{"", utils.TaskReceived, true},
+		{"", utils.TaskConverted, true},
+		{utils.TaskReceived, utils.TaskDownloaded, true},
+		{utils.TaskReceived, utils.TaskQueued, true},
+		{utils.TaskQueued, utils.TaskConverting, true},
+		{utils.TaskConverted, utils.TaskUploaded, true},
+		{utils.TaskSent, utils.TaskDelivered, true},
+		{utils.TaskConverting, utils.TaskQueued, false},
+		{utils.TaskSent, utils.TaskConverted, false},
+		{utils.TaskQueued, utils.TaskQueued, false},
+		{utils.TaskConverting, utils.TaskFailed, true},
+		{utils.TaskUploaded, utils.TaskFailed, true},
+		{utils.TaskSent, utils.TaskFailed, false},
+		{utils.TaskDelivered, utils.TaskFailed, false},
+		{utils.TaskFailed, utils.TaskQueued, true},
+		{utils.TaskFailed, utils.TaskConverting, false},
+		{utils.TaskFailed, utils.TaskFailed, false},
+	}
+	for _, test := range tests {
+		if got := CanTransition(test.from, test.to); got != test.want {
+			t.Errorf("CanTransition(%q, %q) = %t, want %t", test.from, test.to, got, test.want)
+		}
+	}
+}
+
+func TestStages(t *testing.T) {
+	start := time.Date(2022, 6, 1, 12, 0, 0, 0, time.UTC)
+	transitions := []Transition{
+		{State: utils.TaskReceived, At: start},
+		{State: utils.TaskQueued, At: start.Add(2 * time.Second)},
+		{State: utils.TaskConverting, At: start.Add(3 * time.Second)},
+		{State: utils.TaskSent, At: start.Add(10 * time.Second)},
+	}
+	want := []Stage{
+		{From: utils.TaskReceived, To: utils.TaskQueued, Duration: 2 * time.Second},
+		{From: utils.TaskQueued, To: utils.TaskConverting, Duration: time.Second},
+		{From: utils.TaskConverting, To: utils.TaskSent, Duration: 7 * time.Second},
+	}
+	got := Stages(transitions)
+	if len(got) != len(want) {
+		t.Fatalf("got %d stages, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("stage %d is %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if stages := Stages(transitions[:1]); len(stages) != 0 {
+		t.Errorf("a single transition made stages %+v", stages)
+	}
+	if stages := Stages(nil); len(stages) != 0 {
+		t.Errorf("no transitions made stages %+v", stages)
+	}
+}
@@ -0,0 +1,97 @@
+package task
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/deven96/whatsticker/master/store"
+	"github.com/deven96/whatsticker/master/whatsapp"
+	"github.com/deven96/whatsticker/utils"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// FailureConsumer tells senders about tasks the worker could not complete
+type FailureConsumer struct {
+	PushMetricsTo *amqp.Queue
+	// DeadLetterTo keeps failure events, along with the media, so the
+	// tasks can be requeued. nil drops failed tasks
+	DeadLetterTo *amqp.Queue
+	Store        store.Store
+}
+
+// notifyFailure replies to the message the task was made from with the
+// localized message for reason
+func notifyFailure(task utils.ConvertTask, reason utils.FailureReason, violations []string, detail string) {
+	language := task.Language
+	if language == "" {
+		language = LanguageFor(task.From)
+	}
+	task.Failure = Localize(language, reason, violations, detail)
+	sendFailure(task)
+}
+
+// sendFailure tells the sender why their sticker could not be made
+func sendFailure(task utils.ConvertTask) {
+	failed := whatsapp.TextResponse{
+		Response: whatsapp.Response{
+			To:      task.From,
+			Type:    "text",
+			Context: whatsapp.Context{MessageID: task.MessageID},
+		},
+		Text: whatsapp.Text{
+			Body: task.Failure,
+		},
+	}
+	textbytes, _ := json.Marshal(&failed)
+	whatsapp.SendMessage(textbytes, task.PhoneNumberID)
+}
+
+func (consumer *FailureConsumer) Execute(ch *amqp.Channel, delivery *amqp.Delivery) {
+	var event utils.FailureEvent
+	if err := json.Unmarshal(delivery.Body, &event); err != nil {
+		log.Errorf("Error delivering failure event %s", err)
+		delivery.Ack(false)
+		return
+	}
+	task := event.Task
+	log.Infof("Task for %s failed with %s: %s", task.MessageID, event.Reason, event.Detail)
+	notifyFailure(task, event.Reason, event.Violations, event.Detail)
+	store.RecordTask(consumer.Store, task, utils.TaskFailed, event.Detail)
+	os.Remove(task.ConvertedPath)
+	if consumer.DeadLetterTo != nil {
+		utils.PublishBytesToQueue(ch, consumer.DeadLetterTo, delivery.Body)
+	} else {
+		os.Remove(task.MediaPath)
+	}
+
+	stickerMetric := utils.StickerizationMetric{
+		InitialMediaLength: task.DataLen,
+		FinalMediaLength:   event.ConvertedSize,
+		MediaType:          task.MediaType,
+		IsGroupMessage:     task.IsGroup,
+		MessageSender:      task.MessageSender,
+		TimeOfRequest:      task.TimeOfRequest,
+		Validated:          false,
+		Timings:            task.Timings,
+	}
+	metricsBytes, _ := json.Marshal(&stickerMetric)
+	utils.PublishBytesToQueue(ch, consumer.PushMetricsTo, metricsBytes)
+	delivery.Ack(false)
+}
+
+// ExpiredConsumer removes the media of dead lettered tasks left too long to be requeued
+type ExpiredConsumer struct{}
+
+func (consumer *ExpiredConsumer) Execute(ch *amqp.Channel, delivery *amqp.Delivery) {
+	var event utils.FailureEvent
+	if err := json.Unmarshal(delivery.Body, &event); err != nil {
+		log.Errorf("Error delivering expired dead letter %s", err)
+		delivery.Ack(false)
+		return
+	}
+	log.Infof("Dead letter for %s expired, removing %s", event.Task.MessageID, event.Task.MediaPath)
+	os.Remove(event.Task.MediaPath)
+	delivery.Ack(false)
+}
@@ -0,0 +1,72 @@
+package task
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/deven96/whatsticker/master/store"
+	"github.com/deven96/whatsticker/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// copyFile copies src to dst, the converted and history directories
+// may be on different volumes so renaming is not an option
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err = os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
+
+// keep records a sticker sent as mediaID in its sender's history and
+// keeps a copy of it, unless the sender opted out of history
+func (consumer *StickerConsumer) keep(task utils.ConvertTask, mediaID string) {
+	if consumer.Store == nil {
+		return
+	}
+	user, err := consumer.Store.GetUser(task.From)
+	if err != nil {
+		log.Errorf("Could not look up user %s: %s", task.From, err)
+		return
+	}
+	if user.OptedOut(store.OptOutHistory) {
+		return
+	}
+	key := path.Join(task.From, task.MessageID+filepath.Ext(task.ConvertedPath))
+	if err = copyFile(task.ConvertedPath, store.StickerPath(key)); err != nil {
+		log.Errorf("Could not keep sticker %s: %s", task.ConvertedPath, err)
+		return
+	}
+	options, _ := json.Marshal(&task.Options)
+	sticker := &store.Sticker{
+		PhoneNumber:  task.From,
+		SourceSHA256: task.SourceSHA256,
+		StorageKey:   key,
+		MediaType:    task.MediaType,
+		Options:      string(options),
+		MediaID:      mediaID,
+		UploadedAt:   time.Now().UTC(),
+	}
+	if err = consumer.Store.AddSticker(sticker); err != nil {
+		log.Errorf("Could not record sticker %s: %s", key, err)
+		os.Remove(store.StickerPath(key))
+	}
+}
@@ -0,0 +1,131 @@
+package task
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/deven96/whatsticker/utils"
+)
+
+// DefaultLanguage is used for senders whose language is not known
+const DefaultLanguage = "en"
+
+// failureMessages are the replies sent for each failure reason, by
+// language. Messages for ReasonSpecViolation are followed by what was wrong
+var failureMessages = map[string]map[utils.FailureReason]string{
+	"en": {
+		utils.ReasonConversionFailed: "Sorry, your media could not be turned into a sticker",
+		utils.ReasonSpecViolation:    "Sorry, your sticker could not be made to meet WhatsApp's requirements",
+		utils.ReasonUploadFailed:     "Sorry, your sticker was made but could not be sent, please try again",
+	},
+	"es": {
+		utils.ReasonConversionFailed: "Lo sentimos, no pudimos convertir tu archivo en un sticker",
+		utils.ReasonSpecViolation:    "Lo sentimos, tu sticker no cumple los requisitos de WhatsApp",
+		utils.ReasonUploadFailed:     "Lo sentimos, tu sticker se creó pero no se pudo enviar, inténtalo de nuevo",
+	},
+	"pt": {
+		utils.ReasonConversionFailed: "Desculpe, não foi possível transformar sua mídia em figurinha",
+		utils.ReasonSpecViolation:    "Desculpe, sua figurinha não atende aos requisitos do WhatsApp",
+		utils.ReasonUploadFailed:     "Desculpe, sua figurinha foi criada mas não pôde ser enviada, tente novamente",
+	},
+	"fr": {
+		utils.ReasonConversionFailed: "Désolé, votre média n'a pas pu être transformé en sticker",
+		utils.ReasonSpecViolation:    "Désolé, votre sticker ne respecte pas les exigences de WhatsApp",
+		utils.ReasonUploadFailed:     "Désolé, votre sticker a été créé mais n'a pas pu être envoyé, veuillez réessayer",
+	},
+}
+
+// violationMessages describe the worker/spec rules a sticker can break, by language
+var violationMessages = map[string]map[string]string{
+	"en": {
+		"dimensions":     "it is not 512x512",
+		"static_size":    "it is over 100KB",
+		"animated_size":  "it is over 500KB",
+		"frame_duration": "some frames are too short",
+		"duration":       "it is longer than 10 seconds",
+		"exif":           "its metadata could not be written",
+	},
+	"es": {
+		"dimensions":     "no mide 512x512",
+		"static_size":    "pesa más de 100KB",
+		"animated_size":  "pesa más de 500KB",
+		"frame_duration": "algunos fotogramas duran muy poco",
+		"duration":       "dura más de 10 segundos",
+		"exif":           "no se pudieron escribir sus metadatos",
+	},
+	"pt": {
+		"dimensions":     "não tem 512x512",
+		"static_size":    "tem mais de 100KB",
+		"animated_size":  "tem mais de 500KB",
+		"frame_duration": "alguns quadros são curtos demais",
+		"duration":       "dura mais de 10 segundos",
+		"exif":           "não foi possível gravar seus metadados",
+	},
+	"fr": {
+		"dimensions":     "il ne fait pas 512x512",
+		"static_size":    "il dépasse 100 Ko",
+		"animated_size":  "il dépasse 500 Ko",
+		"frame_duration": "certaines images sont trop courtes",
+		"duration":       "il dure plus de 10 secondes",
+		"exif":           "ses métadonnées n'ont pas pu être écrites",
+	},
+}
+
+// callingCodeLanguages guesses a language from the calling code of a
+// phone number, longest codes are listed first so +351 beats +35
+var callingCodeLanguages = []struct {
+	Code     string
+	Language string
+}{
+	{"351", "pt"}, {"244", "pt"}, {"258", "pt"},
+	{"221", "fr"}, {"225", "fr"}, {"237", "fr"},
+	{"52", "es"}, {"54", "es"}, {"56", "es"}, {"57", "es"}, {"58", "es"}, {"51", "es"},
+	{"55", "pt"}, {"34", "es"}, {"33", "fr"}, {"32", "fr"},
+}
+
+// LanguageFor guesses the language of a sender from their phone number
+func LanguageFor(phoneNumber string) string {
+	number := strings.TrimPrefix(phoneNumber, "+")
+	for _, entry := range callingCodeLanguages {
+		if strings.HasPrefix(number, entry.Code) {
+			return entry.Language
+		}
+	}
+	return DefaultLanguage
+}
+
+// describeViolations describes the violated rules in language, leaving
+// out rules with no translation. Only english speakers get the raw
+// detail when no rule is known
+func describeViolations(language string, violations []string, detail string) string {
+	var described []string
+	for _, rule := range violations {
+		if message, ok := violationMessages[language][rule]; ok {
+			described = append(described, message)
+		}
+	}
+	if len(described) == 0 && len(violations) == 0 && language == DefaultLanguage {
+		return detail
+	}
+	return strings.Join(described, ", ")
+}
+
+// Localize returns the message telling a sender about a failure in
+// language, falling back to DefaultLanguage for missing translations
+func Localize(language string, reason utils.FailureReason, violations []string, detail string) string {
+	message, ok := failureMessages[language][reason]
+	if !ok {
+		language = DefaultLanguage
+		message, ok = failureMessages[language][reason]
+	}
+	if !ok {
+		return failureMessages[language][utils.ReasonConversionFailed]
+	}
+	if reason != utils.ReasonSpecViolation {
+		return message
+	}
+	if described := describeViolations(language, violations, detail); described != "" {
+		message = fmt.Sprintf("%s (%s)", message, described)
+	}
+	return message
+}
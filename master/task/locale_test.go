@@ -0,0 +1,57 @@
+package task
+
+import (
+	"testing"
+
+	"github.com/deven96/whatsticker/utils"
+)
+
+func TestLanguageFor(t *testing.T) {
+	tests := map[string]string{
+		"+351912345678": "pt",
+		"5511912345678": "pt",
+		"34612345678":   "es",
+		"33612345678":   "fr",
+		"2348012345678": DefaultLanguage,
+	}
+	for number, want := range tests {
+		if got := LanguageFor(number); got != want {
+			t.Errorf("LanguageFor(%s) = %s, want %s", number, got, want)
+		}
+	}
+}
+
+func TestLocalize(t *testing.T) {
+	tests := []struct {
+		language   string
+		reason     utils.FailureReason
+		violations []string
+		detail     string
+		want       string
+	}{
+		{"en", utils.ReasonUploadFailed, nil, "graph api returned 500", "Sorry, your sticker was made but could not be sent, please try again"},
+		{"en", utils.ReasonSpecViolation, []string{"animated_size", "duration"}, "animated sticker is 600KB, over 500KB, animated sticker runs 12.0s, over 10s",
+			"Sorry, your sticker could not be made to meet WhatsApp's requirements (it is over 500KB, it is longer than 10 seconds)"},
+		{"en", utils.ReasonSpecViolation, nil, "not a webp file", "Sorry, your sticker could not be made to meet WhatsApp's requirements (not a webp file)"},
+		{"es", utils.ReasonSpecViolation, []string{"dimensions"}, "sticker is 300x512 instead of 512x512",
+			"Lo sentimos, tu sticker no cumple los requisitos de WhatsApp (no mide 512x512)"},
+		{"fr", utils.ReasonSpecViolation, nil, "not a webp file", "Désolé, votre sticker ne respecte pas les exigences de WhatsApp"},
+		{"pt", utils.ReasonSpecViolation, []string{"unknown_rule"}, "something new", "Desculpe, sua figurinha não atende aos requisitos do WhatsApp"},
+		{"de", utils.ReasonConversionFailed, nil, "", "Sorry, your media could not be turned into a sticker"},
+	}
+	for _, test := range tests {
+		if got := Localize(test.language, test.reason, test.violations, test.detail); got != test.want {
+			t.Errorf("Localize(%s, %s, %v) = %q, want %q", test.language, test.reason, test.violations, got, test.want)
+		}
+	}
+}
+
+func TestEveryLanguageDescribesEveryRule(t *testing.T) {
+	for language := range failureMessages {
+		for rule := range violationMessages[DefaultLanguage] {
+			if _, ok := violationMessages[language][rule]; !ok {
+				t.Errorf("%s has no description of %s", language, rule)
+			}
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package task
+
+import (
+	"encoding/json"
+
+	"github.com/deven96/whatsticker/master/store"
+	"github.com/deven96/whatsticker/utils"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	log "github.com/sirupsen/logrus"
+)
+
+// StateConsumer records the states the worker reports tasks moving to
+type StateConsumer struct {
+	Store store.Store
+}
+
+func (consumer *StateConsumer) Execute(ch *amqp.Channel, delivery *amqp.Delivery) {
+	var event utils.TaskStateEvent
+	if err := json.Unmarshal(delivery.Body, &event); err != nil {
+		log.Errorf("Error delivering task state %s", err)
+		delivery.Ack(false)
+		return
+	}
+	log.Debugf("Task %s is %s", event.MessageID, event.State)
+	store.RecordTaskAt(consumer.Store, event.MessageID, event.From, event.MediaType, event.State, "", event.At)
+	delivery.Ack(false)
+}
@@ -3,7 +3,9 @@ package task
 import (
 	"encoding/json"
 	"os"
+	"time"
 
+	"github.com/deven96/whatsticker/master/store"
 	"github.com/deven96/whatsticker/master/whatsapp"
 	"github.com/deven96/whatsticker/utils"
 
@@ -16,6 +18,8 @@ const CompletedMessage = "Done Stickerizing"
 
 type StickerConsumer struct {
 	PushMetricsTo *amqp.Queue
+	// Store keeps the history of stickers sent and task states, nil to keep neither
+	Store store.Store
 }
 
 func (consumer *StickerConsumer) Execute(ch *amqp.Channel, delivery *amqp.Delivery) {
@@ -33,6 +37,8 @@ func (consumer *StickerConsumer) Execute(ch *amqp.Channel, delivery *amqp.Delive
 		MessageSender:      task.MessageSender,
 		TimeOfRequest:      task.TimeOfRequest,
 		Validated:          false,
+		Quality:            task.Quality,
+		Timings:            task.Timings,
 	}
 	metricsBytes, _ := json.Marshal(&stickerMetric)
 	// perform task
@@ -40,34 +46,88 @@ func (consumer *StickerConsumer) Execute(ch *amqp.Channel, delivery *amqp.Delive
 	data, err := os.ReadFile(task.ConvertedPath)
 	if err != nil {
 		log.Errorf("Failed to read %s: %s\n", task.ConvertedPath, err)
+		notifyFailure(task, utils.ReasonUploadFailed, nil, err.Error())
+		store.RecordTask(consumer.Store, task, utils.TaskFailed, err.Error())
 		utils.PublishBytesToQueue(ch, consumer.PushMetricsTo, []byte(metricsBytes))
+		delivery.Ack(false)
 		return
 	}
 	stickerMetric.FinalMediaLength = len(data)
-	// Upload WebP
-	id, err := whatsapp.UploadSticker(task.ConvertedPath, task.PhoneNumberID)
+	var mediaID, replyID string
+	task.Timings.UploadStarted = time.Now()
+	if task.MediaType == "sticker" {
+		replyID, err = consumer.sendExtracted(&task)
+	} else {
+		mediaID, replyID, err = consumer.sendSticker(&task)
+	}
+	stickerMetric.Timings = task.Timings
 	if err != nil {
 		log.Errorf("Failed to upload file: %v\n", err)
+		notifyFailure(task, utils.ReasonUploadFailed, nil, err.Error())
+		store.RecordTask(consumer.Store, task, utils.TaskFailed, err.Error())
+		os.Remove(task.ConvertedPath)
 		metricsBytes, _ = json.Marshal(&stickerMetric)
 		utils.PublishBytesToQueue(ch, consumer.PushMetricsTo, []byte(metricsBytes))
+		delivery.Ack(false)
 		return
 	}
-	sticker := whatsapp.StickerResponse{
-		Response: whatsapp.Response{
-			To:      task.From,
-			Type:    "sticker",
-			Context: whatsapp.Context{MessageID: task.MessageID},
-		},
-		Sticker: whatsapp.Sticker{
-			ID: id,
-		},
-	}
-	stickerBytes, _ := json.Marshal(&sticker)
-	whatsapp.SendMessage(stickerBytes, task.PhoneNumberID)
 
+	task.Timings.Sent = time.Now()
+	stickerMetric.Timings = task.Timings
+	store.RecordTask(consumer.Store, task, utils.TaskSent, "")
+	if consumer.Store != nil && replyID != "" {
+		if err = consumer.Store.SetTaskReply(task.MessageID, replyID); err != nil {
+			log.Errorf("Could not record reply to %s: %s", task.MessageID, err)
+		}
+	}
+	if mediaID != "" {
+		consumer.keep(task, mediaID)
+	}
 	os.Remove(task.ConvertedPath)
 	stickerMetric.Validated = true
 	metricsBytes, _ = json.Marshal(&stickerMetric)
 	utils.PublishBytesToQueue(ch, consumer.PushMetricsTo, []byte(metricsBytes))
 	delivery.Ack(false)
 }
+
+// sendSticker uploads the converted WebP and replies with it as a
+// sticker, returning the media ID it was uploaded as and the reply's ID
+func (consumer *StickerConsumer) sendSticker(task *utils.ConvertTask) (string, string, error) {
+	id, err := whatsapp.UploadSticker(task.ConvertedPath, task.PhoneNumberID)
+	if err != nil {
+		return "", "", err
+	}
+	task.Timings.Uploaded = time.Now()
+	store.RecordTask(consumer.Store, *task, utils.TaskUploaded, "")
+	replyID, err := whatsapp.SendSticker(task.From, task.MessageID, id, task.PhoneNumberID)
+	return id, replyID, err
+}
+
+// sendExtracted uploads a reversed sticker and replies with it as
+// an image for static stickers or a video for animated ones, returning
+// the reply's ID
+func (consumer *StickerConsumer) sendExtracted(task *utils.ConvertTask) (string, error) {
+	mimeType := "image/png"
+	if task.Animated {
+		mimeType = "video/mp4"
+	}
+	id, err := whatsapp.UploadMedia(task.ConvertedPath, mimeType, task.PhoneNumberID)
+	if err != nil {
+		return "", err
+	}
+	task.Timings.Uploaded = time.Now()
+	store.RecordTask(consumer.Store, *task, utils.TaskUploaded, "")
+	response := whatsapp.Response{
+		To:      task.From,
+		Type:    "image",
+		Context: whatsapp.Context{MessageID: task.MessageID},
+	}
+	var messageBytes []byte
+	if task.Animated {
+		response.Type = "video"
+		messageBytes, _ = json.Marshal(&whatsapp.VideoResponse{Response: response, Video: whatsapp.MediaObject{ID: id}})
+	} else {
+		messageBytes, _ = json.Marshal(&whatsapp.ImageResponse{Response: response, Image: whatsapp.MediaObject{ID: id}})
+	}
+	return whatsapp.SendMessageID(messageBytes, task.PhoneNumberID)
+}
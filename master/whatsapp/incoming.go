@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -37,6 +38,24 @@ type ChangeValue struct {
 	Metadata         Metadata  `json:"metadata"`
 	Contacts         []Contact `json:"contacts"`
 	Messages         []Message `json:"messages"`
+	Statuses         []Status  `json:"statuses"`
+}
+
+// Status : a delivery receipt for a message the bot sent
+type Status struct {
+	ID          string `json:"id"`
+	Status      string `json:"status"` // sent, delivered, read or failed
+	Timestamp   string `json:"timestamp"`
+	RecipientID string `json:"recipient_id"`
+}
+
+// At : when the status changed, now if the timestamp is unreadable
+func (s Status) At() time.Time {
+	i, err := strconv.ParseInt(s.Timestamp, 10, 64)
+	if err != nil {
+		return time.Now()
+	}
+	return time.Unix(i, 0)
 }
 
 type Message struct {
@@ -49,10 +68,16 @@ type Message struct {
 	} `json:"text"`
 	Sticker struct {
 		Media
-		Animated string `json:"animated"`
+		Animated bool `json:"animated"`
 	} `json:"sticker"`
-	Image Media `json:"image"`
-	Video Media `json:"video"`
+	Image    Media `json:"image"`
+	Video    Media `json:"video"`
+	Document struct {
+		Media
+		Filename string `json:"filename"`
+	} `json:"document"`
+	// ReceivedAt is when the webhook carrying the message was handled
+	ReceivedAt time.Time `json:"-"`
 }
 
 func (m Message) Time() string {
@@ -69,6 +94,7 @@ type Media struct {
 	MimeType string `json:"mime_type"`
 	SHA256   string `json:"sha256"`
 	ID       string `json:"id"`
+	Caption  string `json:"caption"`
 }
 
 type MediaURLResponse struct {
@@ -89,7 +115,7 @@ type Metadata struct {
 }
 
 func (incoming Message) IsMedia() bool {
-	return incoming.Type == "video" || incoming.Type == "image"
+	return incoming.Type == "video" || incoming.Type == "image" || incoming.Type == "sticker" || incoming.Type == "document"
 }
 
 func (incoming Message) MediaType() string {
@@ -100,6 +126,8 @@ func (incoming Message) MediaType() string {
 		return incoming.Image.MimeType
 	case "sticker":
 		return incoming.Sticker.MimeType
+	case "document":
+		return incoming.Document.MimeType
 	default:
 		return "unknown"
 	}
@@ -113,11 +141,27 @@ func (incoming Message) MediaID() string {
 		return incoming.Image.ID
 	case "sticker":
 		return incoming.Sticker.ID
+	case "document":
+		return incoming.Document.ID
 	default:
 		return "unknown"
 	}
 }
 
+// Caption : the caption sent along with media, if any
+func (incoming Message) Caption() string {
+	switch incoming.Type {
+	case "video":
+		return incoming.Video.Caption
+	case "image":
+		return incoming.Image.Caption
+	case "document":
+		return incoming.Document.Caption
+	default:
+		return ""
+	}
+}
+
 func (incoming Message) IsSticker() bool {
 	return incoming.Type == "sticker"
 }
@@ -130,6 +174,17 @@ func (incoming Message) IsImage() bool {
 	return incoming.Type == "image"
 }
 
+func (incoming Message) IsDocument() bool {
+	return incoming.Type == "document"
+}
+
+// IsVisualDocument : documents which claim to be images or videos,
+// as sent by users who want to avoid whatsapp recompressing them
+func (incoming Message) IsVisualDocument() bool {
+	mimeType := incoming.Document.MimeType
+	return incoming.IsDocument() && (strings.HasPrefix(mimeType, "image/") || strings.HasPrefix(mimeType, "video/"))
+}
+
 // IsGroup : Right now twilio doesn't allow adding whatsapp
 // business to a group but we keep this here for now
 func (incoming Message) IsGroup() bool {
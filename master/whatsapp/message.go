@@ -38,6 +38,21 @@ type Sticker struct {
 	ID string `json:"id"`
 }
 
+type ImageResponse struct {
+	Response
+	Image MediaObject `json:"image"`
+}
+
+type VideoResponse struct {
+	Response
+	Video MediaObject `json:"video"`
+}
+
+// MediaObject references previously uploaded media
+type MediaObject struct {
+	ID string `json:"id"`
+}
+
 type TextResponse struct {
 	Response
 	Text Text `json:"text"`
@@ -48,11 +63,25 @@ type Text struct {
 }
 
 func SendMessage(message []byte, phoneNumberID string) error {
+	_, err := SendMessageID(message, phoneNumberID)
+	return err
+}
+
+// SentResponse : what the graph api answers a sent message with
+type SentResponse struct {
+	Messages []struct {
+		ID string `json:"id"`
+	} `json:"messages"`
+}
+
+// SendMessageID sends message and returns the id it was sent with,
+// which delivery statuses refer to
+func SendMessageID(message []byte, phoneNumberID string) (string, error) {
 	// Create a new request using http
 	url := fmt.Sprintf("%s%s/messages", FacebookGraphAPI, phoneNumberID)
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(message))
 	if err != nil {
-		return err
+		return "", err
 	}
 	// add authorization header to the req
 	req.Header.Add("Authorization", BearerToken)
@@ -62,12 +91,35 @@ func SendMessage(message []byte, phoneNumberID string) error {
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return "", err
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		bodyText, _ := ioutil.ReadAll(resp.Body)
 		fmt.Printf("%s\n", bodyText)
-		return errors.New(string(bodyText))
+		return "", errors.New(string(bodyText))
+	}
+	var sent SentResponse
+	if err = json.NewDecoder(resp.Body).Decode(&sent); err != nil || len(sent.Messages) == 0 {
+		// the message went out, only its id is unknown
+		return "", nil
+	}
+	return sent.Messages[0].ID, nil
+}
+
+// SendSticker : replies to message replyTo sent by to with the uploaded
+// sticker mediaID, returning the id of the reply
+func SendSticker(to string, replyTo string, mediaID string, phoneNumberID string) (string, error) {
+	sticker := StickerResponse{
+		Response: Response{
+			To:      to,
+			Type:    "sticker",
+			Context: Context{MessageID: replyTo},
+		},
+		Sticker: Sticker{
+			ID: mediaID,
+		},
 	}
-	return nil
+	stickerBytes, _ := json.Marshal(&sticker)
+	return SendMessageID(stickerBytes, phoneNumberID)
 }
@@ -32,6 +32,11 @@ func escapeQuotes(s string) string {
 
 // UploadSticker returns the ID
 func UploadSticker(path string, phoneNumberID string) (string, error) {
+	return UploadMedia(path, "image/webp", phoneNumberID)
+}
+
+// UploadMedia uploads the file at path as mimeType and returns the ID
+func UploadMedia(path string, mimeType string, phoneNumberID string) (string, error) {
 	// Create a new request using http
 	url := fmt.Sprintf("%s%s/media", FacebookGraphAPI, phoneNumberID)
 	data, err := os.Open(path)
@@ -44,14 +49,14 @@ func UploadSticker(path string, phoneNumberID string) (string, error) {
 	h := make(textproto.MIMEHeader)
 	h.Set("Content-Disposition",
 		fmt.Sprintf(`form-data; name="file"; filename="%s"`, escapeQuotes(data.Name())))
-	h.Set("Content-Type", "image/webp")
+	h.Set("Content-Type", mimeType)
 	fw, err := writer.CreatePart(h)
 	if err != nil {
 		return "", nil
 	}
 	_, err = io.Copy(fw, data)
 	formField, err := writer.CreateFormField("type")
-	_, err = formField.Write([]byte(`image/webp`))
+	_, err = formField.Write([]byte(mimeType))
 
 	formField, err = writer.CreateFormField("messaging_product")
 	_, err = formField.Write([]byte(`whatsapp`))
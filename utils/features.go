@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// FeatureBackgroundRemoval gates the nobg conversion option
+const FeatureBackgroundRemoval = "background_removal"
+
+// KnownFeatures lists every feature flag
+var KnownFeatures = []string{FeatureBackgroundRemoval}
+
+// FeatureSource : keeps feature flag overrides where every replica sees them
+type FeatureSource interface {
+	// FeatureFlags returns every overridden flag
+	FeatureFlags() (map[string]bool, error)
+	// SetFeatureFlag overrides a flag
+	SetFeatureFlag(name string, enabled bool) error
+}
+
+// featureCacheTTL is how long overrides are read from a FeatureSource
+// before reading them again, so toggles reach other replicas this late
+const featureCacheTTL = 10 * time.Second
+
+var (
+	featureLock   sync.RWMutex
+	featureSource FeatureSource
+	features      = map[string]bool{}
+	featuresRead  time.Time
+)
+
+// UseFeatureSource : keeps feature flag overrides in source rather than
+// in the process, which only the process setting them would see
+func UseFeatureSource(source FeatureSource) {
+	featureLock.Lock()
+	defer featureLock.Unlock()
+	featureSource = source
+	features = map[string]bool{}
+	featuresRead = time.Time{}
+}
+
+// featureOverrides returns the overridden flags, from the cache while it is fresh
+func featureOverrides() map[string]bool {
+	featureLock.RLock()
+	source, overrides, read := featureSource, features, featuresRead
+	featureLock.RUnlock()
+	if source == nil || time.Since(read) < featureCacheTTL {
+		return overrides
+	}
+	fresh, err := source.FeatureFlags()
+	if err != nil {
+		// keep serving the last overrides read rather than flip flags on an error
+		log.Errorf("Could not read feature flags: %s", err)
+		fresh = overrides
+	}
+	featureLock.Lock()
+	features, featuresRead = fresh, time.Now()
+	featureLock.Unlock()
+	return fresh
+}
+
+// FeatureEnabled : reports whether a feature flag is on, flags default
+// to the FEATURE_<NAME> environment variable e.g FEATURE_BACKGROUND_REMOVAL=true
+func FeatureEnabled(name string) bool {
+	if enabled, ok := featureOverrides()[name]; ok {
+		return enabled
+	}
+	enabled, _ := strconv.ParseBool(os.Getenv("FEATURE_" + strings.ToUpper(name)))
+	return enabled
+}
+
+// SetFeature : overrides a feature flag, in the FeatureSource if there is one
+func SetFeature(name string, enabled bool) error {
+	featureLock.Lock()
+	defer featureLock.Unlock()
+	if featureSource != nil {
+		if err := featureSource.SetFeatureFlag(name, enabled); err != nil {
+			return err
+		}
+	}
+	overrides := map[string]bool{name: enabled}
+	for flag, on := range features {
+		if flag != name {
+			overrides[flag] = on
+		}
+	}
+	features = overrides
+	return nil
+}
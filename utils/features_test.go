@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// sharedFlags stands in for the database replicas share
+type sharedFlags map[string]bool
+
+func (s sharedFlags) FeatureFlags() (map[string]bool, error) {
+	flags := map[string]bool{}
+	for name, enabled := range s {
+		flags[name] = enabled
+	}
+	return flags, nil
+}
+
+func (s sharedFlags) SetFeatureFlag(name string, enabled bool) error {
+	s[name] = enabled
+	return nil
+}
+
+func TestFeatureSource(t *testing.T) {
+	t.Setenv("FEATURE_BACKGROUND_REMOVAL", "false")
+	shared := sharedFlags{}
+	UseFeatureSource(shared)
+	defer UseFeatureSource(nil)
+	if FeatureEnabled(FeatureBackgroundRemoval) {
+		t.Error("flag on without an override")
+	}
+	if err := SetFeature(FeatureBackgroundRemoval, true); err != nil {
+		t.Fatal(err)
+	}
+	if !shared[FeatureBackgroundRemoval] {
+		t.Error("override was not kept in the source")
+	}
+	if !FeatureEnabled(FeatureBackgroundRemoval) {
+		t.Error("override did not reach the replica setting it")
+	}
+	// another replica turning the flag off shows once the cache expires
+	shared[FeatureBackgroundRemoval] = false
+	if !FeatureEnabled(FeatureBackgroundRemoval) {
+		t.Error("cache was not used")
+	}
+	featureLock.Lock()
+	featuresRead = time.Now().Add(-featureCacheTTL)
+	featureLock.Unlock()
+	if FeatureEnabled(FeatureBackgroundRemoval) {
+		t.Error("override from another replica was not read")
+	}
+}
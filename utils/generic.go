@@ -44,13 +44,18 @@ func ListenForCtrlC(service string) {
 
 // GetQueue : Returns an AMQP Queue
 func GetQueue(ch *amqp.Channel, queueName string, durable bool) *amqp.Queue {
+	return GetQueueWithArgs(ch, queueName, durable, nil)
+}
+
+// GetQueueWithArgs : Returns an AMQP Queue declared with args such as x-message-ttl
+func GetQueueWithArgs(ch *amqp.Channel, queueName string, durable bool, args amqp.Table) *amqp.Queue {
 	q, err := ch.QueueDeclare(
 		queueName,
 		durable, // durable
 		false,   // delete when unused
 		false,   // exclusive
 		false,   // no-wait
-		nil,     // arguments
+		args,    // arguments
 	)
 	FailOnError(err, "Failed to connect to RabbitMQ")
 	return &q
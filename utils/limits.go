@@ -0,0 +1,13 @@
+package utils
+
+// limits whatsapp places on stickers, shared by the worker that makes
+// them and the logger that measures them
+// https://faq.whatsapp.com/general/how-to-create-stickers-for-whatsapp
+const (
+	MaxStaticBytes   = 100 * 1024
+	MaxAnimatedBytes = 500 * 1024
+)
+
+// MaxClipSeconds is the longest animated sticker whatsapp accepts, so
+// the most of a video the worker converts and the master charges for
+const MaxClipSeconds = 10
@@ -1,6 +1,9 @@
 package utils
 
-import "os"
+import (
+	"os"
+	"time"
+)
 
 type AMQPConfig struct {
 	Uri     string // AMQP URI
@@ -14,18 +17,76 @@ func GetAMQPConfig() *AMQPConfig {
 	}
 }
 
+// Fit modes for ConvertOptions.Fit
+const (
+	FitContain = "contain" // letterbox the whole of the media
+	FitCover   = "cover"   // crop the media to fill the sticker
+)
+
+// ConvertOptions : user requested tweaks applied during conversion
+type ConvertOptions struct {
+	Trim             bool    // trim fully transparent borders before fitting to 512x512
+	RemoveBackground bool    // cut the subject out of the image, see FeatureBackgroundRemoval
+	Outline          int     // width in pixels of a white die cut outline, 0 for none
+	Shadow           bool    // draw a drop shadow beneath the sticker
+	TopText          string  // meme style text across the top
+	BottomText       string  // meme style text across the bottom
+	Banner           string  // text on a translucent strip along the bottom
+	Mask             string  // shape to cut the sticker into: circle, rounded, heart or star
+	Start            float64 // offset in seconds videos start from
+	End              float64 // offset in seconds videos end at, 0 for the end of the video
+	Speed            float64 // playback speed multiplier for videos, 0 leaves it unchanged
+	Reverse          bool    // play videos backwards
+	Boomerang        bool    // play videos forwards then backwards
+	Fit              string  // FitContain or FitCover, how media is fit onto the sticker
+	PackName         string  // sticker pack name written into the sticker metadata
+	PackAuthor       string  // sticker pack publisher written into the sticker metadata
+}
+
+// MediaProbe : what the master learnt about downloaded media
+type MediaProbe struct {
+	Codec    string
+	Width    int
+	Height   int
+	Duration float64 // seconds, 0 for still images
+	Frames   int
+}
+
 // ConvertTask
 type ConvertTask struct {
 	MediaPath     string
 	ConvertedPath string
 	DataLen       int
 	MediaType     string
+	Text          string // body rendered for text stickers
+	Animated      bool   // set for animated stickers being reversed
 	From          string
 	PhoneNumberID string
 	MessageID     string
 	IsGroup       bool
 	MessageSender string
 	TimeOfRequest string //time.Time
+	Options       ConvertOptions
+	Failure       string // set by the master when the sticker cannot be sent, for the sender
+	Quality       int    // webp quality static stickers were encoded at
+	Probe         *MediaProbe
+	Language      string // language the sender chose for replies, empty to guess
+	SourceSHA256  string // hex digest of the media or text the sticker was made from
+	Timings       Timings
+}
+
+// Timings : when a task reached each point of the pipeline, zero for
+// points it did not reach. Stage latencies are measured between them
+type Timings struct {
+	Received        time.Time // the webhook was handled
+	DownloadStarted time.Time
+	Downloaded      time.Time
+	Queued          time.Time // published for the worker
+	ConvertStarted  time.Time // the worker picked the task up
+	Converted       time.Time
+	UploadStarted   time.Time
+	Uploaded        time.Time
+	Sent            time.Time
 }
 
 // StickerizationMetric
@@ -37,4 +98,53 @@ type StickerizationMetric struct {
 	MessageSender      string
 	TimeOfRequest      string
 	Validated          bool
+	Quality            int
+	Throttled          string // name of the quota the request went over, empty if it did not
+	Access             string // set only on the access decision published for each message, which counts nothing else
+	Timings            Timings
+}
+
+// FailureReason : codes why a task could not be turned into a sticker
+type FailureReason string
+
+const (
+	ReasonConversionFailed FailureReason = "conversion_failed"
+	ReasonSpecViolation    FailureReason = "spec_violation"
+	ReasonUploadFailed     FailureReason = "upload_failed"
+)
+
+// FailureEvent : published when a task fails after it was queued, so
+// the sender can be told instead of never hearing back
+type FailureEvent struct {
+	Task   ConvertTask
+	Reason FailureReason
+	Detail string // what went wrong, passed on to english speaking senders when nothing better is known
+	// Violations are the worker/spec rules a sticker broke, for ReasonSpecViolation
+	Violations []string
+	// ConvertedSize is the size in bytes of the sticker that failed, 0 if none was made
+	ConvertedSize int
+}
+
+// TaskState : where a task is in the pipeline
+type TaskState string
+
+const (
+	TaskReceived   TaskState = "received"
+	TaskDownloaded TaskState = "downloaded"
+	TaskQueued     TaskState = "queued"
+	TaskConverting TaskState = "converting"
+	TaskConverted  TaskState = "converted"
+	TaskUploaded   TaskState = "uploaded"
+	TaskSent       TaskState = "sent"
+	TaskDelivered  TaskState = "delivered"
+	TaskFailed     TaskState = "failed"
+)
+
+// TaskStateEvent : published by the worker as it moves a task along
+type TaskStateEvent struct {
+	MessageID string
+	From      string
+	MediaType string
+	State     TaskState
+	At        time.Time
 }
@@ -0,0 +1,76 @@
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// BackgroundRemover cuts the background out of the image at src and
+// writes the result with a transparent background to the png at dst
+type BackgroundRemover interface {
+	Remove(src string, dst string) error
+}
+
+var backgroundRemovers = map[string]BackgroundRemover{
+	"floodfill": FloodFillRemover{Fuzz: 12, Feather: 1},
+}
+
+// RegisterBackgroundRemover : makes a remover selectable with the
+// BACKGROUND_REMOVER environment variable
+func RegisterBackgroundRemover(name string, remover BackgroundRemover) {
+	backgroundRemovers[name] = remover
+}
+
+func getBackgroundRemover() BackgroundRemover {
+	if remover, ok := backgroundRemovers[os.Getenv("BACKGROUND_REMOVER")]; ok {
+		return remover
+	}
+	return backgroundRemovers["floodfill"]
+}
+
+// FloodFillRemover treats everything connected to the corners of the
+// image within Fuzz percent of the corner colour as background, which
+// works well for subjects photographed against plain backdrops
+type FloodFillRemover struct {
+	// Fuzz is how far in percent a colour may drift from the corner colour
+	Fuzz int
+	// Feather is the blur radius in pixels used to soften the cut edge
+	Feather int
+}
+
+// imageSize returns the width and height of the image at path
+func imageSize(path string) (int, int, error) {
+	var width, height int
+	out, err := exec.Command("identify", "-format", "%w %h", path+"[0]").Output()
+	if err != nil {
+		return 0, 0, err
+	}
+	_, err = fmt.Sscanf(string(out), "%d %d", &width, &height)
+	return width, height, err
+}
+
+func (remover FloodFillRemover) Remove(src string, dst string) error {
+	width, height, err := imageSize(src)
+	if err != nil {
+		return err
+	}
+	args := []string{src, "-alpha", "set", "-fuzz", fmt.Sprintf("%d%%", remover.Fuzz), "-fill", "none"}
+	for _, corner := range [][2]int{{0, 0}, {width - 1, 0}, {0, height - 1}, {width - 1, height - 1}} {
+		args = append(args, "-draw", fmt.Sprintf("color %d,%d floodfill", corner[0], corner[1]))
+	}
+	if remover.Feather > 0 {
+		args = append(args, "-channel", "A", "-blur", fmt.Sprintf("0x%d", remover.Feather), "-level", "50%,100%", "+channel")
+	}
+	args = append(args, "+fuzz", "PNG32:"+dst)
+	cmd := exec.Command("convert", args...)
+	var errb bytes.Buffer
+	cmd.Stderr = &errb
+	if err = cmd.Run(); err != nil {
+		log.Errorf("Failed to remove background %s", errb.String())
+	}
+	return err
+}
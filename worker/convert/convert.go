@@ -7,9 +7,11 @@ import (
 	"image"
 	"os"
 	"os/exec"
+	"time"
 
 	"github.com/deven96/whatsticker/utils"
 	"github.com/deven96/whatsticker/worker/metadata"
+	"github.com/deven96/whatsticker/worker/spec"
 
 	amqp "github.com/rabbitmq/amqp091-go"
 	log "github.com/sirupsen/logrus"
@@ -19,7 +21,47 @@ import (
 const maxVideoFileSize = 512000
 
 type ConvertConsumer struct {
-	PushTo *amqp.Queue
+	PushTo         *amqp.Queue
+	PushFailuresTo *amqp.Queue
+	// PushStatesTo receives TaskStateEvents, nil to not report states
+	PushStatesTo *amqp.Queue
+}
+
+// report tells the master task moved to state
+func (consumer *ConvertConsumer) report(ch *amqp.Channel, task utils.ConvertTask, state utils.TaskState) {
+	if consumer.PushStatesTo == nil {
+		return
+	}
+	event := utils.TaskStateEvent{
+		MessageID: task.MessageID,
+		From:      task.From,
+		MediaType: task.MediaType,
+		State:     state,
+		At:        time.Now(),
+	}
+	eventBytes, _ := json.Marshal(&event)
+	utils.PublishBytesToQueue(ch, consumer.PushStatesTo, eventBytes)
+}
+
+// fail publishes a FailureEvent for task so the master can let the
+// sender know, and acknowledges the delivery since retrying won't help
+func (consumer *ConvertConsumer) fail(ch *amqp.Channel, delivery *amqp.Delivery, task utils.ConvertTask, reason utils.FailureReason, err error) {
+	event := utils.FailureEvent{
+		Task:   task,
+		Reason: reason,
+		Detail: err.Error(),
+	}
+	if violated, ok := err.(*spec.ViolationError); ok {
+		event.Violations = violated.Report.Rules()
+	}
+	if info, statErr := os.Stat(task.ConvertedPath); statErr == nil {
+		event.ConvertedSize = int(info.Size())
+	}
+	eventBytes, _ := json.Marshal(&event)
+	utils.PublishBytesToQueue(ch, consumer.PushFailuresTo, eventBytes)
+	// the media is kept for the master to dead letter or remove
+	os.Remove(task.ConvertedPath)
+	delivery.Ack(false)
 }
 
 func (consumer *ConvertConsumer) Consume(ch *amqp.Channel, delivery *amqp.Delivery) {
@@ -31,21 +73,41 @@ func (consumer *ConvertConsumer) Consume(ch *amqp.Channel, delivery *amqp.Delive
 
 	// perform task
 	log.Infof("performing task %#v", task)
+	task.Timings.ConvertStarted = time.Now()
+	consumer.report(ch, task, utils.TaskConverting)
 	var err error
 	switch task.MediaType {
 	case "image":
-		err = convertImage(task)
+		task.Quality, err = convertImage(task)
 	case "video":
-		err = convertVideo(task, 60)
+		err = convertAnimated(task)
+	case "gif":
+		err = convertGif(task)
+	case "text":
+		task.Quality, err = renderText(task)
+	case "sticker":
+		err = reverseSticker(task)
 	default:
 		return
 	}
 	if err != nil {
 		log.Errorf("Failed to Convert %s to WebP %s", task.MediaType, err)
+		consumer.fail(ch, delivery, task, utils.ReasonConversionFailed, err)
 		return
 	}
-	metadata.GenerateMetadata(task.ConvertedPath)
-	utils.PublishBytesToQueue(ch, consumer.PushTo, delivery.Body)
+	if task.MediaType != "sticker" {
+		metadata.GenerateMetadata(task.ConvertedPath, task.Options.PackName, task.Options.PackAuthor)
+		if err = validateSticker(task); err != nil {
+			log.Errorf("Converted %s fails sticker spec %s", task.MediaType, err)
+			// tell the sender instead of uploading a sticker whatsapp would reject
+			consumer.fail(ch, delivery, task, utils.ReasonSpecViolation, err)
+			return
+		}
+	}
+	task.Timings.Converted = time.Now()
+	consumer.report(ch, task, utils.TaskConverted)
+	body, _ := json.Marshal(&task)
+	utils.PublishBytesToQueue(ch, consumer.PushTo, body)
 
 	os.Remove(task.MediaPath)
 	delivery.Ack(false)
@@ -68,21 +130,50 @@ func getImageDimensions(path string) (int, int) {
 }
 
 // https://imagemagick.org/script/command-line-options.php#resize
-func resizeImage(task utils.ConvertTask) error {
-	cmd := *exec.Command("convert", task.MediaPath, "-resize", "512x512", "-background", "black", "-compose", "Copy", "-gravity", "center", "-extent", "512x512", "-quality", "92", task.MediaPath)
+// the image is fit onto a transparent canvas and written out as png
+// so any alpha in the source survives until it is encoded to webp
+func resizeImage(src string, output string, options utils.ConvertOptions) error {
+	args := []string{src, "-alpha", "set"}
+	if options.Trim {
+		// a transparent border makes trim only remove fully transparent edges
+		args = append(args, "-bordercolor", "none", "-border", "1", "-trim", "+repage")
+	}
+	size := 512 - 2*styleMargin(options)
+	fit := fmt.Sprintf("%dx%d", size, size)
+	if fillsCanvas(options) {
+		args = append(args, "-resize", fit+"^", "-gravity", "center", "-extent", fit)
+	}
+	args = append(args, "-resize", fit, "-background", "none", "-gravity", "center", "-extent", "512x512", "PNG32:"+output)
+	cmd := exec.Command("convert", args...)
 	err := cmd.Run()
 	return err
 }
 
-func convertImage(task utils.ConvertTask) error {
-	err := resizeImage(task)
+// convertImage returns the quality the sticker was encoded at
+func convertImage(task utils.ConvertTask) (int, error) {
+	source := task.MediaPath
+	if task.Options.RemoveBackground {
+		source = task.MediaPath + ".nobg.png"
+		defer os.Remove(source)
+		if err := getBackgroundRemover().Remove(task.MediaPath, source); err != nil {
+			return 0, err
+		}
+	}
+	resized := task.MediaPath + ".png"
+	defer os.Remove(resized)
+	err := resizeImage(source, resized, task.Options)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	cmd := *exec.Command("cwebp", task.MediaPath, "-resize", "512", "512", "-o", task.ConvertedPath)
-	err = cmd.Run()
-
-	return err
+	stages, cleanup, err := frameStages(task)
+	defer cleanup()
+	if err != nil {
+		return 0, err
+	}
+	if err = applyStages(resized, stages); err != nil {
+		return 0, err
+	}
+	return encodeStatic(resized, task.ConvertedPath)
 }
 
 func isTargetSize(path string) bool {
@@ -96,25 +187,62 @@ func isTargetSize(path string) bool {
 	return true
 }
 
-func convertVideo(task utils.ConvertTask, qValue int) error {
+// convertAnimated stickerizes a video, decoding it to frames first
+// when options have to be applied frame by frame
+func convertAnimated(task utils.ConvertTask) error {
+	stages, cleanup, err := frameStages(task)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+	// scored once, to pick the window to clip and predict how large it encodes
+	scores, err := sceneScores(task.MediaPath)
+	if err != nil {
+		log.Errorf("Could not score scenes of %s: %s", task.MediaPath, err)
+	}
+	start, length := clipRange(task, scores)
+	input := clipInput(task.MediaPath, start, length)
+	rung := pickProfile(length*playbackScale(task.Options), meanMotion(windowScores(scores, start, length)))
+	if len(stages) == 0 {
+		return encodeAnimated(task, input, func(profile videoProfile) string {
+			return withEffects(fmt.Sprintf("fps=fps=%d,mpdecimate,%s", profile.FPS, scaleFilter(profile.Size, fillsCanvas(task.Options))), task.Options)
+		}, rung)
+	}
+	dir, err := makeFrameDir(task.MediaPath)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	if err = extractFrames(input, dir, task.Options); err != nil {
+		return err
+	}
+	if err = applyToFrames(dir, stages); err != nil {
+		return err
+	}
+	// effects were applied and frames fit to 512x512 as they were
+	// extracted, so lower rungs can only drop frames and quality
+	return encodeAnimated(task, framesInput(dir), func(profile videoProfile) string {
+		return fmt.Sprintf("fps=fps=%d,mpdecimate", profile.FPS)
+	}, rung)
+}
+
+// convertVideo encodes input to an animated webp in a single pass,
+// truncate cuts the webp off at maxVideoFileSize
+func convertVideo(task utils.ConvertTask, input []string, filter string, qValue int, truncate bool) error {
 	log.Infof("Q value is %d\n", qValue)
-	commandString := fmt.Sprintf("ffmpeg -i %s -fs %d  -filter:v fps=fps=20 -compression_level 0 -q:v %d -loop 0 -preset picture -an -vsync 0 -s 512:512  %s", task.MediaPath, maxVideoFileSize, qValue, task.ConvertedPath)
-	cmd := *exec.Command("bash", "-c", commandString)
+	args := append([]string{"-y"}, input...)
+	if truncate {
+		args = append(args, "-fs", fmt.Sprint(maxVideoFileSize))
+	}
+	args = append(args, "-filter:v", filter, "-compression_level", "0", "-q:v", fmt.Sprint(qValue), "-loop", "0", "-preset", "picture", "-an", "-vsync", "0", task.ConvertedPath)
+	cmd := *exec.Command("ffmpeg", args...)
 	var outb, errb bytes.Buffer
 	cmd.Stdout = &outb
 	cmd.Stderr = &errb
 
 	err := cmd.Run()
-
-	// validate converted video is the right size
-	// FIXME: Use libwep codec and specify file size directly?
-	//commandString = fmt.Sprintf("ffmpeg -i %s -vcodec libwebp -fs %d -preset default -loop 0 -an -vsync 0 -vf 'scale=512:512:force_original_aspect_ratio=decrease,pad=512:512:(512-iw)/2:(512-ih)/2:color=black' -quality %d -y %s", task.ConvertedPath, maxVideoFileSize, videoQuality, task.ConvertedPath)
-	if err == nil && !(isTargetSize(task.ConvertedPath)) {
-		log.Info("Reconverting video..\n")
-		os.Remove(task.ConvertedPath)
-		err = convertVideo(task, qValue-10)
+	if err != nil {
+		log.Errorf("Failed to encode %s %s", task.MediaPath, errb.String())
 	}
-
 	return err
-
 }
@@ -0,0 +1,98 @@
+package convert
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/deven96/whatsticker/utils"
+)
+
+// requireTools skips tests needing the tools the worker shells out to
+func requireTools(t *testing.T, tools ...string) {
+	t.Helper()
+	for _, tool := range tools {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is not installed", tool)
+		}
+	}
+}
+
+// writeCutout writes a png with an opaque red square on a transparent background
+func writeCutout(t *testing.T, path string) {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, 300, 200))
+	for y := 50; y < 150; y++ {
+		for x := 100; x < 200; x++ {
+			img.Set(x, y, color.NRGBA{R: 255, A: 255})
+		}
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	if err = png.Encode(out, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// decodeWebP decodes the webp at path to an image with dwebp
+func decodeWebP(t *testing.T, path string) image.Image {
+	t.Helper()
+	decoded := path + ".png"
+	if out, err := exec.Command("dwebp", path, "-o", decoded).CombinedOutput(); err != nil {
+		t.Fatalf("dwebp %s: %s %s", path, err, out)
+	}
+	in, err := os.Open(decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	img, err := png.Decode(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return img
+}
+
+func alphaAt(img image.Image, x, y int) uint8 {
+	return color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA).A
+}
+
+func TestConvertImageKeepsTransparency(t *testing.T) {
+	requireTools(t, "convert", "cwebp", "dwebp")
+	dir := t.TempDir()
+	cutout := filepath.Join(dir, "cutout.png")
+	writeCutout(t, cutout)
+	webp := filepath.Join(dir, "cutout.webp")
+	if out, err := exec.Command("cwebp", "-lossless", cutout, "-o", webp).CombinedOutput(); err != nil {
+		t.Fatalf("cwebp: %s %s", err, out)
+	}
+	for name, source := range map[string]string{"png": cutout, "webp": webp} {
+		t.Run(name, func(t *testing.T) {
+			task := utils.ConvertTask{MediaPath: source, ConvertedPath: source + ".sticker.webp"}
+			if _, err := convertImage(task); err != nil {
+				t.Fatalf("convertImage: %s", err)
+			}
+			sticker := decodeWebP(t, task.ConvertedPath)
+			if bounds := sticker.Bounds(); bounds.Dx() != 512 || bounds.Dy() != 512 {
+				t.Fatalf("sticker is %dx%d", bounds.Dx(), bounds.Dy())
+			}
+			// the padding added to fit the canvas and the source's own
+			// transparent border must stay transparent around the square
+			for _, corner := range [][2]int{{0, 0}, {511, 0}, {0, 511}, {511, 511}, {256, 100}, {100, 256}} {
+				if a := alphaAt(sticker, corner[0], corner[1]); a != 0 {
+					t.Errorf("alpha at %v is %d, want 0", corner, a)
+				}
+			}
+			if a := alphaAt(sticker, 256, 256); a != 255 {
+				t.Errorf("alpha at the centre is %d, want 255", a)
+			}
+		})
+	}
+}
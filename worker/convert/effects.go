@@ -0,0 +1,43 @@
+package convert
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/deven96/whatsticker/utils"
+)
+
+// playbackScale is how many seconds of sticker each second of the
+// source becomes once speed and boomerang are applied
+func playbackScale(options utils.ConvertOptions) float64 {
+	scale := 1.0
+	if options.Speed > 0 {
+		scale /= options.Speed
+	}
+	if options.Boomerang {
+		scale *= 2
+	}
+	return scale
+}
+
+// withEffects prefixes the ffmpeg filter with the temporal effects in
+// options, which run before frames are resampled and encoded
+func withEffects(filter string, options utils.ConvertOptions) string {
+	var effects []string
+	if options.Speed > 0 && options.Speed != 1 {
+		effects = append(effects, fmt.Sprintf("setpts=PTS/%.2f", options.Speed))
+	}
+	if options.Reverse {
+		effects = append(effects, "reverse")
+	}
+	chain := strings.Join(append(effects, filter), ",")
+	if options.Boomerang {
+		// play the clip forwards then backwards so it loops seamlessly
+		prefix := ""
+		if len(effects) > 0 {
+			prefix = strings.Join(effects, ",") + ","
+		}
+		chain = fmt.Sprintf("%ssplit[forward][backward];[backward]reverse[reversed];[forward][reversed]concat=n=2:v=1:a=0,%s", prefix, filter)
+	}
+	return chain
+}
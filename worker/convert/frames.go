@@ -0,0 +1,134 @@
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"github.com/deven96/whatsticker/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// frameStage processes a 512x512 png in place
+type frameStage func(path string) error
+
+// frameStages returns the stages options apply to every frame in
+// order, and a cleanup for anything rendered ahead of time for them
+func frameStages(task utils.ConvertTask) ([]frameStage, func(), error) {
+	var stages []frameStage
+	var rendered []string
+	cleanup := func() {
+		for _, path := range rendered {
+			os.Remove(path)
+		}
+	}
+	if needsMask(task.Options) {
+		mask := task.MediaPath + ".mask.png"
+		if err := renderMask(mask, task.Options.Mask, styleMargin(task.Options)); err != nil {
+			return nil, cleanup, err
+		}
+		rendered = append(rendered, mask)
+		stages = append(stages, func(path string) error {
+			return maskImage(path, mask)
+		})
+	}
+	if needsStyling(task.Options) {
+		stages = append(stages, func(path string) error {
+			return styleImage(path, task.Options)
+		})
+	}
+	if needsOverlay(task.Options) {
+		overlay := task.MediaPath + ".overlay.png"
+		if err := renderOverlay(overlay, task.Options); err != nil {
+			return nil, cleanup, err
+		}
+		rendered = append(rendered, overlay)
+		stages = append(stages, func(path string) error {
+			return overlayImage(path, overlay)
+		})
+	}
+	return stages, cleanup, nil
+}
+
+// applyStages runs each stage over the png at path
+func applyStages(path string, stages []frameStage) error {
+	for _, stage := range stages {
+		if err := stage(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// frameRate is the rate videos are sampled at when stickerized
+const frameRate = 20
+
+// framePattern names extracted frames in the order ffmpeg reads them back
+const framePattern = "%05d.png"
+
+// extractFrames decodes the video read by the ffmpeg input arguments
+// into transparent 512x512 png frames in dir, leaving room on every
+// side for stages that draw beyond the edges of the video
+func extractFrames(input []string, dir string, options utils.ConvertOptions) error {
+	size := 512 - 2*styleMargin(options)
+	fit := fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease", size, size)
+	if fillsCanvas(options) {
+		fit = fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=increase,crop=%d:%d", size, size, size, size)
+	}
+	filter := withEffects(fmt.Sprintf("fps=%d,%s,format=rgba,pad=512:512:(ow-iw)/2:(oh-ih)/2:color=black@0", frameRate, fit), options)
+	args := append([]string{"-y"}, input...)
+	args = append(args, "-vf", filter, "-an", filepath.Join(dir, framePattern))
+	cmd := exec.Command("ffmpeg", args...)
+	var errb bytes.Buffer
+	cmd.Stderr = &errb
+	err := cmd.Run()
+	if err != nil {
+		log.Errorf("Failed to extract frames %s", errb.String())
+	}
+	return err
+}
+
+// framesInput are the ffmpeg input arguments reading frames back from dir
+func framesInput(dir string) []string {
+	return []string{"-framerate", fmt.Sprint(frameRate), "-i", filepath.Join(dir, framePattern)}
+}
+
+// applyToFrames runs the stages over every frame in dir, spreading the
+// frames across as many goroutines as there are cpus
+func applyToFrames(dir string, stages []frameStage) error {
+	frames, err := filepath.Glob(filepath.Join(dir, "*.png"))
+	if err != nil {
+		return err
+	}
+	paths := make(chan string)
+	errs := make(chan error, len(frames))
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for path := range paths {
+				if err := applyStages(path, stages); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	for _, frame := range frames {
+		paths <- frame
+	}
+	close(paths)
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// makeFrameDir creates the directory frames of task are extracted to
+func makeFrameDir(mediaPath string) (string, error) {
+	dir := mediaPath + ".frames"
+	return dir, os.MkdirAll(dir, os.ModePerm)
+}
@@ -0,0 +1,191 @@
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+
+	"github.com/deven96/whatsticker/utils"
+)
+
+// minGifDelay is the delay in hundredths of a second browsers fall back
+// to for gifs that ask for 0 or 1, which would otherwise play far too fast
+const minGifDelay = 2
+
+const defaultGifDelay = 10
+
+// gifFrame is a fully composited frame and how long it shows for
+type gifFrame struct {
+	Image *image.RGBA
+	Delay float64 // seconds
+}
+
+// coalesceGif composites each frame of g over the ones before it
+// following their disposal methods, merging consecutive frames that
+// come out identical so their delays add up instead
+func coalesceGif(g *gif.GIF) []gifFrame {
+	bounds := image.Rect(0, 0, g.Config.Width, g.Config.Height)
+	canvas := image.NewRGBA(bounds)
+	var frames []gifFrame
+	for i, paletted := range g.Image {
+		var previous *image.RGBA
+		disposal := byte(gif.DisposalNone)
+		if i < len(g.Disposal) {
+			disposal = g.Disposal[i]
+		}
+		if disposal == gif.DisposalPrevious {
+			previous = image.NewRGBA(bounds)
+			copy(previous.Pix, canvas.Pix)
+		}
+		draw.Draw(canvas, paletted.Bounds(), paletted, paletted.Bounds().Min, draw.Over)
+
+		delay := defaultGifDelay
+		if i < len(g.Delay) {
+			delay = g.Delay[i]
+			if delay < minGifDelay {
+				delay = defaultGifDelay
+			}
+		}
+		seconds := float64(delay) / 100
+		if last := len(frames) - 1; last >= 0 && bytes.Equal(frames[last].Image.Pix, canvas.Pix) {
+			frames[last].Delay += seconds
+		} else {
+			frame := image.NewRGBA(bounds)
+			copy(frame.Pix, canvas.Pix)
+			frames = append(frames, gifFrame{Image: frame, Delay: seconds})
+		}
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, paletted.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+	return frames
+}
+
+// applyGifTiming applies the clip offsets and temporal effects in
+// options to frames, since ffmpeg never sees the gif itself
+func applyGifTiming(frames []gifFrame, options utils.ConvertOptions) []gifFrame {
+	var clipped []gifFrame
+	elapsed := 0.0
+	for _, frame := range frames {
+		if elapsed >= options.Start && (options.End == 0 || elapsed < options.End) {
+			clipped = append(clipped, frame)
+		}
+		elapsed += frame.Delay
+	}
+	if len(clipped) == 0 {
+		clipped = frames
+	}
+	if options.Speed > 0 {
+		for i := range clipped {
+			clipped[i].Delay /= options.Speed
+		}
+	}
+	if options.Reverse || options.Boomerang {
+		reversed := make([]gifFrame, len(clipped))
+		for i, frame := range clipped {
+			reversed[len(clipped)-1-i] = frame
+		}
+		if options.Reverse {
+			clipped, reversed = reversed, clipped
+		}
+		if options.Boomerang {
+			clipped = append(clipped, reversed...)
+		}
+	}
+	// whatsapp rejects animated stickers longer than utils.MaxClipSeconds
+	elapsed = 0
+	for i, frame := range clipped {
+		elapsed += frame.Delay
+		if elapsed > utils.MaxClipSeconds {
+			return clipped[:i]
+		}
+	}
+	return clipped
+}
+
+// extractGifFrames decodes the gif at src into 512x512 png frames in dir
+// run through stages, and writes an ffmpeg concat list holding each
+// frame's own duration, returning the path of that list
+func extractGifFrames(src string, dir string, options utils.ConvertOptions, stages []frameStage) (string, error) {
+	file, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	decoded, err := gif.DecodeAll(file)
+	if err != nil {
+		return "", err
+	}
+	frames := applyGifTiming(coalesceGif(decoded), options)
+	if len(frames) == 0 {
+		return "", fmt.Errorf("%s has no frames", src)
+	}
+
+	// trimming frame by frame would make the frames different sizes
+	resizeOptions := options
+	resizeOptions.Trim = false
+	var list bytes.Buffer
+	var path string
+	for i, frame := range frames {
+		path, err = filepath.Abs(filepath.Join(dir, fmt.Sprintf(framePattern, i)))
+		if err != nil {
+			return "", err
+		}
+		if err = writePNG(path, frame.Image); err != nil {
+			return "", err
+		}
+		if err = resizeImage(path, path, resizeOptions); err != nil {
+			return "", err
+		}
+		if err = applyStages(path, stages); err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&list, "file '%s'\nduration %.3f\n", path, frame.Delay)
+	}
+	// the concat demuxer ignores the duration of the final entry
+	// unless the file is listed once more
+	fmt.Fprintf(&list, "file '%s'\n", path)
+	listPath := filepath.Join(dir, "frames.txt")
+	return listPath, os.WriteFile(listPath, list.Bytes(), 0644)
+}
+
+func writePNG(path string, img image.Image) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	return png.Encode(out, img)
+}
+
+// convertGif stickerizes a gif keeping the timing of every frame
+// instead of resampling it to a fixed frame rate
+func convertGif(task utils.ConvertTask) error {
+	stages, cleanup, err := frameStages(task)
+	defer cleanup()
+	if err != nil {
+		return err
+	}
+	dir, err := makeFrameDir(task.MediaPath)
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	list, err := extractGifFrames(task.MediaPath, dir, task.Options, stages)
+	if err != nil {
+		return err
+	}
+	// frames keep their own timing so only quality varies down the ladder
+	return encodeAnimated(task, []string{"-f", "concat", "-safe", "0", "-i", list}, func(videoProfile) string {
+		return "null"
+	}, 0)
+}
@@ -0,0 +1,99 @@
+package convert
+
+import (
+	"fmt"
+	"math"
+	"os"
+
+	"github.com/deven96/whatsticker/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// videoProfile is one rung of the encoding ladder
+type videoProfile struct {
+	FPS     int
+	Size    int // the video is scaled to fit Size x Size within the 512x512 canvas
+	Quality int
+}
+
+// videoLadder runs from the best looking profile to the smallest,
+// encoding walks down it until the sticker fits maxVideoFileSize
+var videoLadder = []videoProfile{
+	{FPS: 20, Size: 512, Quality: 75},
+	{FPS: 20, Size: 512, Quality: 60},
+	{FPS: 15, Size: 512, Quality: 50},
+	{FPS: 15, Size: 448, Quality: 45},
+	{FPS: 12, Size: 448, Quality: 40},
+	{FPS: 10, Size: 384, Quality: 35},
+	{FPS: 10, Size: 320, Quality: 25},
+	{FPS: 8, Size: 256, Quality: 20},
+}
+
+// estimateSize predicts the bytes an animated webp encoded with profile
+// takes for seconds of video whose frames differ by motion on average.
+// Lossy webp spends roughly 0.05 to 0.45 bits per pixel depending on
+// quality, and animated webp only stores what changes between frames
+func estimateSize(profile videoProfile, seconds float64, motion float64) float64 {
+	quality := float64(profile.Quality) / 100
+	bitsPerPixel := 0.05 + 0.4*quality*quality
+	changed := math.Max(0.3, math.Min(0.3+motion*5, 1.2))
+	frames := seconds * float64(profile.FPS)
+	pixels := float64(profile.Size * profile.Size)
+	return frames * pixels * bitsPerPixel * changed / 8
+}
+
+// meanMotion averages scene scores, falling back to assuming a lot of
+// motion when the video could not be scored
+func meanMotion(scores []float64) float64 {
+	if len(scores) == 0 {
+		return 0.2
+	}
+	sum := 0.0
+	for _, score := range scores {
+		sum += score
+	}
+	return sum / float64(len(scores))
+}
+
+// pickProfile returns the index of the first profile on the ladder
+// predicted to fit, so long videos skip encodes that could never fit
+func pickProfile(seconds float64, motion float64) int {
+	for i, profile := range videoLadder {
+		// leave headroom since the estimate is rough
+		if estimateSize(profile, seconds, motion) <= maxVideoFileSize*0.9 {
+			return i
+		}
+	}
+	return len(videoLadder) - 1
+}
+
+// scaleFilter fits frames into size x size, centred on a transparent
+// 512x512 canvas so the aspect ratio of the source is kept, cover
+// crops frames to fill size x size instead
+func scaleFilter(size int, cover bool) string {
+	fit := fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=decrease", size, size)
+	if cover {
+		fit = fmt.Sprintf("scale=%d:%d:force_original_aspect_ratio=increase,crop=%d:%d", size, size, size, size)
+	}
+	return fit + ",format=rgba,pad=512:512:(ow-iw)/2:(oh-ih)/2:color=black@0"
+}
+
+// encodeAnimated encodes input with the filter built for each profile,
+// walking down the ladder from rung until the sticker fits. The last
+// rung falls back to truncating the sticker at the size limit
+func encodeAnimated(task utils.ConvertTask, input []string, filter func(videoProfile) string, rung int) error {
+	for ; rung < len(videoLadder); rung++ {
+		profile := videoLadder[rung]
+		last := rung == len(videoLadder)-1
+		log.Infof("Encoding %s with profile %+v", task.MediaPath, profile)
+		if err := convertVideo(task, input, filter(profile), profile.Quality, last); err != nil {
+			return err
+		}
+		if isTargetSize(task.ConvertedPath) {
+			return nil
+		}
+		log.Info("Reconverting video..\n")
+		os.Remove(task.ConvertedPath)
+	}
+	return fmt.Errorf("could not fit %s within %d bytes", task.MediaPath, maxVideoFileSize)
+}
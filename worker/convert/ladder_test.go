@@ -0,0 +1,12 @@
+package convert
+
+import "testing"
+
+func TestMeanMotion(t *testing.T) {
+	if motion := meanMotion(nil); motion != 0.2 {
+		t.Errorf("unscored video has motion %f", motion)
+	}
+	if motion := meanMotion([]float64{0.1, 0.3}); motion != 0.2 {
+		t.Errorf("mean of 0.1 and 0.3 is %f", motion)
+	}
+}
@@ -0,0 +1,99 @@
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os/exec"
+	"strings"
+
+	"github.com/deven96/whatsticker/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+func needsMask(options utils.ConvertOptions) bool {
+	return options.Mask != ""
+}
+
+// fillsCanvas : media is cropped to fill the sticker rather than
+// letterboxed, masked media always fills so the mask has no empty bands
+func fillsCanvas(options utils.ConvertOptions) bool {
+	return needsMask(options) || options.Fit == utils.FitCover
+}
+
+// polygon joins points into an imagemagick polygon primitive
+func polygon(points [][2]float64) string {
+	coords := make([]string, len(points))
+	for i, point := range points {
+		coords[i] = fmt.Sprintf("%.1f,%.1f", point[0], point[1])
+	}
+	return "polygon " + strings.Join(coords, " ")
+}
+
+// heartPoints traces the classic parametric heart curve scaled to
+// fill a box of size centred on the sticker
+func heartPoints(size float64) [][2]float64 {
+	var points [][2]float64
+	scale := size / 34
+	for i := 0; i < 120; i++ {
+		t := 2 * math.Pi * float64(i) / 120
+		x := 16 * math.Pow(math.Sin(t), 3)
+		y := 13*math.Cos(t) - 5*math.Cos(2*t) - 2*math.Cos(3*t) - math.Cos(4*t)
+		// the curve spans y in [-17, 12] so shift it down to centre it
+		points = append(points, [2]float64{256 + x*scale, 256 - (y+2.5)*scale})
+	}
+	return points
+}
+
+// starPoints alternates between outer and inner radii for a five
+// pointed star centred on the sticker
+func starPoints(radius float64) [][2]float64 {
+	var points [][2]float64
+	for i := 0; i < 10; i++ {
+		r := radius
+		if i%2 == 1 {
+			r = radius * 0.45
+		}
+		angle := -math.Pi/2 + math.Pi*float64(i)/5
+		points = append(points, [2]float64{256 + r*math.Cos(angle), 256 + 8 + r*math.Sin(angle)})
+	}
+	return points
+}
+
+// maskPrimitive returns the draw primitive for shape, inset by margin
+func maskPrimitive(shape string, margin int) (string, error) {
+	inner := float64(512 - 2*margin)
+	switch shape {
+	case "circle":
+		return fmt.Sprintf("circle 256,256 256,%d", margin), nil
+	case "rounded":
+		return fmt.Sprintf("roundrectangle %d,%d %d,%d 64,64", margin, margin, 511-margin, 511-margin), nil
+	case "heart":
+		return polygon(heartPoints(inner)), nil
+	case "star":
+		return polygon(starPoints(inner / 2)), nil
+	}
+	return "", fmt.Errorf("unknown mask %s", shape)
+}
+
+// renderMask draws the anti-aliased shape white on a transparent
+// 512x512 png at path, leaving margin for outlines and shadows
+func renderMask(path string, shape string, margin int) error {
+	primitive, err := maskPrimitive(shape, margin)
+	if err != nil {
+		return err
+	}
+	cmd := exec.Command("convert", "-size", "512x512", "xc:none", "-fill", "white", "-draw", primitive, "PNG32:"+path)
+	var errb bytes.Buffer
+	cmd.Stderr = &errb
+	if err = cmd.Run(); err != nil {
+		log.Errorf("Failed to render %s mask %s", shape, errb.String())
+	}
+	return err
+}
+
+// maskImage keeps only the parts of the png at path under the mask
+func maskImage(path string, mask string) error {
+	cmd := exec.Command("convert", path, mask, "-compose", "DstIn", "-composite", "PNG32:"+path)
+	return cmd.Run()
+}
@@ -0,0 +1,61 @@
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+
+	"github.com/deven96/whatsticker/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// shadowOffset is how far the drop shadow falls below and right of the sticker
+const shadowOffset = 6
+
+// styleMargin is the room outlines and shadows need around the sticker
+func styleMargin(options utils.ConvertOptions) int {
+	margin := options.Outline
+	if options.Shadow {
+		margin += shadowOffset
+	}
+	return margin
+}
+
+func needsStyling(options utils.ConvertOptions) bool {
+	return options.Outline > 0 || options.Shadow
+}
+
+// styleArgs returns the imagemagick operators drawing a white die cut
+// outline by dilating the alpha mask, and a soft drop shadow under it
+func styleArgs(options utils.ConvertOptions) []string {
+	var args []string
+	if options.Outline > 0 {
+		args = append(args,
+			"(", "+clone", "-alpha", "extract", "-morphology", "Dilate", fmt.Sprintf("Disk:%d", options.Outline),
+			"-background", "white", "-alpha", "shape", ")",
+			"+swap", "-background", "none", "-compose", "Over", "-composite",
+		)
+	}
+	if options.Shadow {
+		args = append(args,
+			"(", "+clone", "-background", "black", "-shadow", fmt.Sprintf("50x3+%d+%d", shadowOffset, shadowOffset), ")",
+			"+swap", "-background", "none", "-layers", "merge", "+repage",
+			"-gravity", "center", "-extent", "512x512",
+		)
+	}
+	return args
+}
+
+// styleImage outlines and shadows the transparent png at path in place
+func styleImage(path string, options utils.ConvertOptions) error {
+	args := append([]string{path}, styleArgs(options)...)
+	args = append(args, "PNG32:"+path)
+	cmd := exec.Command("convert", args...)
+	var errb bytes.Buffer
+	cmd.Stderr = &errb
+	err := cmd.Run()
+	if err != nil {
+		log.Errorf("Failed to style %s %s", path, errb.String())
+	}
+	return err
+}
@@ -0,0 +1,66 @@
+package convert
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+
+	"github.com/deven96/whatsticker/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// top and bottom meme text each get a band of the sticker this tall
+const memeTextHeight = 128
+
+const memeOutlineWidth = 8
+
+// bannerHeight is the height of the translucent strip behind banner text
+const bannerHeight = 96
+
+func needsOverlay(options utils.ConvertOptions) bool {
+	return options.TopText != "" || options.BottomText != "" || options.Banner != ""
+}
+
+// outlinedTextArgs draws white text outlined in black, the way meme
+// text is drawn, auto sized to fit the width of the sticker
+func outlinedTextArgs(text string, height int) []string {
+	width := 512 - 2*memeOutlineWidth
+	args := []string{"("}
+	args = append(args, captionArgs(text, "black", "black", memeOutlineWidth, width, height)...)
+	args = append(args, captionArgs(text, "white", "none", 0, width, height)...)
+	return append(args, "-background", "none", "-gravity", "center", "-composite", ")")
+}
+
+// renderOverlay draws the caption text requested in options onto a
+// transparent 512x512 png at path, ready to be laid over each frame
+func renderOverlay(path string, options utils.ConvertOptions) error {
+	args := []string{"-size", "512x512", "xc:none"}
+	if options.TopText != "" {
+		args = append(args, outlinedTextArgs(strings.ToUpper(options.TopText), memeTextHeight)...)
+		args = append(args, "-gravity", "north", "-geometry", "+0+8", "-composite")
+	}
+	if options.BottomText != "" {
+		args = append(args, outlinedTextArgs(strings.ToUpper(options.BottomText), memeTextHeight)...)
+		args = append(args, "-gravity", "south", "-geometry", "+0+8", "-composite")
+	}
+	if options.Banner != "" {
+		args = append(args, "(", "-size", "512x96", "xc:rgba(0,0,0,0.6)")
+		args = append(args, captionArgs(options.Banner, "white", "none", 0, 496, bannerHeight-16)...)
+		args = append(args, "-gravity", "center", "-composite", ")", "-gravity", "south", "-geometry", "+0+0", "-composite")
+	}
+	args = append(args, "PNG32:"+path)
+	cmd := exec.Command("convert", args...)
+	var errb bytes.Buffer
+	cmd.Stderr = &errb
+	err := cmd.Run()
+	if err != nil {
+		log.Errorf("Failed to render caption overlay %s", errb.String())
+	}
+	return err
+}
+
+// overlayImage lays the overlay png over the png at path in place
+func overlayImage(path string, overlay string) error {
+	cmd := exec.Command("convert", path, overlay, "-compose", "Over", "-composite", "PNG32:"+path)
+	return cmd.Run()
+}
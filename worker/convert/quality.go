@@ -0,0 +1,75 @@
+package convert
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/deven96/whatsticker/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// exifAllowance is kept free under the size limit for the exif chunk
+// written onto the sticker after it is encoded
+const exifAllowance = 1024
+
+// maxStaticFileSize is the largest a static sticker can encode to
+const maxStaticFileSize = utils.MaxStaticBytes - exifAllowance
+
+// encodeAt encodes the png at src to a webp at dst with cwebp and
+// returns the size of the result
+func encodeAt(src string, dst string, quality int, alphaQuality int) (int, error) {
+	cmd := exec.Command("cwebp", src, "-q", fmt.Sprint(quality), "-alpha_q", fmt.Sprint(alphaQuality), "-m", "6", "-o", dst)
+	if err := cmd.Run(); err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(dst)
+	if err != nil {
+		return 0, err
+	}
+	return int(info.Size()), nil
+}
+
+// encodeStatic binary searches for the highest quality at which the png
+// at src encodes under maxStaticFileSize, writes that to dst and returns
+// the quality used. If even quality 0 is too large the alpha channel is
+// compressed too as a last resort
+func encodeStatic(src string, dst string) (int, error) {
+	size, err := encodeAt(src, dst, 100, 100)
+	if err != nil || size <= maxStaticFileSize {
+		return 100, err
+	}
+	best, last := -1, -1
+	low, high := 0, 99
+	for low <= high {
+		quality := (low + high) / 2
+		last = quality
+		if size, err = encodeAt(src, dst, quality, 100); err != nil {
+			return 0, err
+		}
+		if size <= maxStaticFileSize {
+			best = quality
+			low = quality + 1
+		} else {
+			high = quality - 1
+		}
+	}
+	if best < 0 {
+		log.Infof("%s is too large even at quality 0, compressing alpha", src)
+		if size, err = encodeAt(src, dst, 0, 0); err != nil {
+			return 0, err
+		}
+		if size > maxStaticFileSize {
+			return 0, fmt.Errorf("%s encodes to %d bytes at the lowest quality", src, size)
+		}
+		return 0, nil
+	}
+	// the last encode may have been a higher quality that did not fit
+	if last != best {
+		if _, err = encodeAt(src, dst, best, 100); err != nil {
+			return 0, err
+		}
+	}
+	log.Debugf("Encoded %s at quality %d", src, best)
+	return best, nil
+}
@@ -0,0 +1,36 @@
+package convert
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+
+	"github.com/deven96/whatsticker/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// reverseSticker turns a received webp sticker back into a png for
+// static stickers or an mp4 for animated stickers
+func reverseSticker(task utils.ConvertTask) error {
+	if !task.Animated {
+		cmd := exec.Command("convert", task.MediaPath, task.ConvertedPath)
+		return cmd.Run()
+	}
+	// ffmpeg cannot decode animated webp so let imagemagick
+	// coalesce the frames into a gif first
+	gif := task.MediaPath + ".gif"
+	defer os.Remove(gif)
+	cmd := exec.Command("convert", task.MediaPath, "-coalesce", "-background", "white", "-alpha", "remove", gif)
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+	cmd = exec.Command("ffmpeg", "-y", "-i", gif, "-movflags", "faststart", "-pix_fmt", "yuv420p",
+		"-vf", "scale=trunc(iw/2)*2:trunc(ih/2)*2", "-an", task.ConvertedPath)
+	var errb bytes.Buffer
+	cmd.Stderr = &errb
+	err := cmd.Run()
+	if err != nil {
+		log.Errorf("Failed to encode sticker video %s", errb.String())
+	}
+	return err
+}
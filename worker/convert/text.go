@@ -0,0 +1,114 @@
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/deven96/whatsticker/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// textFont is the bundled font text stickers are drawn with
+const textFont = "/usr/share/fonts/truetype/dejavu/DejaVuSans-Bold.ttf"
+
+// textEmojiFont is handed to pango as a fallback family for emoji glyphs
+const textEmojiFont = "Noto Color Emoji"
+
+// text is fit into a box smaller than the sticker so the outline and
+// shadow are not clipped at the edges
+const textBox = 464
+
+const textOutlineWidth = 10
+
+func getTextFont() string {
+	if font := os.Getenv("STICKER_FONT"); font != "" {
+		return font
+	}
+	return textFont
+}
+
+// escapeText stops imagemagick from treating the text as a
+// filename (@) or a format string (%)
+func escapeText(text string) string {
+	text = strings.NewReplacer(`\`, `\\`, "%", "%%").Replace(text)
+	if strings.HasPrefix(text, "@") {
+		text = `\` + text
+	}
+	return text
+}
+
+// escapeMarkup escapes text for use within pango markup
+func escapeMarkup(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+func hasEmoji(text string) bool {
+	for _, r := range text {
+		if r >= 0x1F000 || (r >= 0x2600 && r <= 0x27BF) || unicode.Is(unicode.Variation_Selector, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// textPointSize estimates the largest point size at which text word
+// wraps into a width x height box, for renderers that cannot auto size
+func textPointSize(text string, width int, height int) int {
+	chars := float64(utf8.RuneCountInString(text))
+	// glyphs average ~0.6em wide and lines sit ~1.2em apart
+	size := math.Sqrt(float64(width*height) / (chars * 0.6 * 1.2))
+	size = math.Min(size, float64(height)/1.2)
+	return int(math.Max(12, math.Min(size, 160)))
+}
+
+// captionArgs returns the imagemagick arguments drawing text in the given
+// fill and stroke, auto sized and word wrapped into a width x height box
+func captionArgs(text, fill, stroke string, strokeWidth int, width int, height int) []string {
+	box := fmt.Sprintf("%dx%d", width, height)
+	if hasEmoji(text) {
+		markup := fmt.Sprintf(`<span font="%s, %s %d" foreground="%s">%s</span>`,
+			"DejaVu Sans Bold", textEmojiFont, textPointSize(text, width, height), fill, escapeMarkup(text))
+		args := []string{"(", "-background", "none", "-size", box, "-gravity", "center", "-define", "pango:align=center", "pango:" + markup}
+		if strokeWidth > 0 {
+			// pango cannot stroke glyphs so grow the alpha of the text instead
+			args = append(args, "-channel", "A", "-morphology", "Dilate", fmt.Sprintf("Disk:%d", strokeWidth/2), "+channel", "-fill", stroke, "-colorize", "100")
+		}
+		return append(args, ")")
+	}
+	return []string{
+		"(", "-background", "none", "-size", box, "-gravity", "center", "-font", getTextFont(),
+		"-fill", fill, "-stroke", stroke, "-strokewidth", fmt.Sprint(strokeWidth),
+		"caption:" + escapeText(text), ")",
+	}
+}
+
+// renderText draws task.Text as white outlined text with a drop shadow
+// on a transparent 512x512 canvas and encodes it to webp, returning
+// the quality it was encoded at
+func renderText(task utils.ConvertTask) (int, error) {
+	rendered := task.ConvertedPath + ".png"
+	defer os.Remove(rendered)
+
+	args := captionArgs(task.Text, "black", "black", textOutlineWidth, textBox, textBox)
+	args = append(args, captionArgs(task.Text, "white", "none", 0, textBox, textBox)...)
+	args = append(args,
+		"-background", "none", "-gravity", "center", "-composite",
+		"(", "+clone", "-background", "black", "-shadow", "60x4+6+6", ")",
+		"+swap", "-background", "none", "-layers", "merge", "+repage",
+		"-gravity", "center", "-extent", "512x512", rendered,
+	)
+	cmd := exec.Command("convert", args...)
+	var errb bytes.Buffer
+	cmd.Stderr = &errb
+	if err := cmd.Run(); err != nil {
+		log.Errorf("Failed to render text %s", errb.String())
+		return 0, err
+	}
+	return encodeStatic(rendered, task.ConvertedPath)
+}
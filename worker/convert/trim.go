@@ -0,0 +1,130 @@
+package convert
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/deven96/whatsticker/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// clipSeconds is how much of a long video is kept when the sender
+// does not pick the part they want
+const clipSeconds = 6
+
+// sceneSampleRate is the rate frames are sampled at to find motion
+const sceneSampleRate = 5
+
+// probeDuration returns the duration in seconds of the media at path
+func probeDuration(path string) (float64, error) {
+	out, err := exec.Command("ffprobe", "-v", "error", "-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1", path).Output()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+}
+
+// sceneScores returns how much each frame sampled at sceneSampleRate
+// differs from the one before it
+func sceneScores(path string) ([]float64, error) {
+	filter := fmt.Sprintf("fps=%d,scale=64:-2,select='gte(scene,0)',metadata=print:file=-", sceneSampleRate)
+	cmd := exec.Command("ffmpeg", "-i", path, "-vf", filter, "-an", "-f", "null", "-")
+	var outb bytes.Buffer
+	cmd.Stdout = &outb
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+	var scores []float64
+	scanner := bufio.NewScanner(&outb)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "lavfi.scene_score="); i >= 0 {
+			score, _ := strconv.ParseFloat(line[i+len("lavfi.scene_score="):], 64)
+			scores = append(scores, score)
+		}
+	}
+	return scores, nil
+}
+
+// windowScores returns the scene scores of the length seconds from start
+func windowScores(scores []float64, start float64, length float64) []float64 {
+	from := int(start * sceneSampleRate)
+	to := int((start + length) * sceneSampleRate)
+	if from > len(scores) {
+		from = len(scores)
+	}
+	if to > len(scores) {
+		to = len(scores)
+	}
+	return scores[from:to]
+}
+
+// bestWindow returns the offset in seconds of the window of the given
+// length with the most motion, the part of a clip people want to loop
+func bestWindow(scores []float64, seconds float64) float64 {
+	window := int(seconds * sceneSampleRate)
+	if window == 0 || len(scores) <= window {
+		return 0
+	}
+	sum := 0.0
+	for _, score := range scores[:window] {
+		sum += score
+	}
+	best, bestSum := 0, sum
+	for i := window; i < len(scores); i++ {
+		sum += scores[i] - scores[i-window]
+		if sum > bestSum {
+			best, bestSum = i-window+1, sum
+		}
+	}
+	return float64(best) / sceneSampleRate
+}
+
+// clipRange returns where to start reading the video and for how long,
+// honouring offsets the sender asked for and otherwise picking the
+// best clipSeconds of videos too long to loop by their scene scores.
+// Lengths are of the source so speed and boomerang are taken into account
+func clipRange(task utils.ConvertTask, scores []float64) (float64, float64) {
+	scale := playbackScale(task.Options)
+	clip, maxClip := clipSeconds/scale, utils.MaxClipSeconds/scale
+	var duration float64
+	var err error
+	if task.Probe != nil && task.Probe.Duration > 0 {
+		// the master already probed the video when it was downloaded
+		duration = task.Probe.Duration
+	} else if duration, err = probeDuration(task.MediaPath); err != nil {
+		log.Errorf("Could not probe duration of %s: %s", task.MediaPath, err)
+		return task.Options.Start, maxClip
+	}
+	start, end := task.Options.Start, task.Options.End
+	if start >= duration {
+		start = 0
+	}
+	if end <= start || end > duration {
+		end = duration
+	}
+	if start == 0 && task.Options.End == 0 && duration > clip {
+		start = bestWindow(scores, clip)
+		end = start + clip
+	}
+	if end-start > maxClip {
+		end = start + maxClip
+	}
+	return start, end - start
+}
+
+// clipInput returns the ffmpeg input arguments reading length
+// seconds of the video at path from start
+func clipInput(path string, start float64, length float64) []string {
+	log.Debugf("Clipping %s from %.2fs for %.2fs", path, start, length)
+	return []string{
+		"-ss", strconv.FormatFloat(start, 'f', 2, 64),
+		"-t", strconv.FormatFloat(length, 'f', 2, 64),
+		"-i", path,
+	}
+}
@@ -0,0 +1,69 @@
+package convert
+
+import (
+	"testing"
+
+	"github.com/deven96/whatsticker/utils"
+)
+
+func TestBestWindow(t *testing.T) {
+	// one second of stillness, one of motion, then stillness again
+	scores := make([]float64, 4*sceneSampleRate)
+	for i := sceneSampleRate; i < 2*sceneSampleRate; i++ {
+		scores[i] = 0.5
+	}
+	if start := bestWindow(scores, 1); start != 1 {
+		t.Errorf("best 1s window starts at %.1fs, want 1s", start)
+	}
+	if start := bestWindow(scores, 10); start != 0 {
+		t.Errorf("window longer than the video starts at %.1fs", start)
+	}
+	if start := bestWindow(nil, 1); start != 0 {
+		t.Errorf("unscored video starts at %.1fs", start)
+	}
+}
+
+func TestWindowScores(t *testing.T) {
+	scores := make([]float64, 4*sceneSampleRate)
+	if got := len(windowScores(scores, 1, 2)); got != 2*sceneSampleRate {
+		t.Errorf("2s window has %d scores", got)
+	}
+	if got := len(windowScores(scores, 3, 6)); got != sceneSampleRate {
+		t.Errorf("window past the end has %d scores", got)
+	}
+	if got := len(windowScores(scores, 10, 1)); got != 0 {
+		t.Errorf("window after the end has %d scores", got)
+	}
+}
+
+func TestClipRange(t *testing.T) {
+	// 20 seconds of video moving only from 12s to 18s
+	scores := make([]float64, 20*sceneSampleRate)
+	for i := 12 * sceneSampleRate; i < 18*sceneSampleRate; i++ {
+		scores[i] = 0.5
+	}
+	tests := []struct {
+		name     string
+		duration float64
+		options  utils.ConvertOptions
+		start    float64
+		length   float64
+	}{
+		{"best window without offsets", 20, utils.ConvertOptions{}, 12, 6},
+		{"short video kept whole", 4, utils.ConvertOptions{}, 0, 4},
+		{"start and end honoured", 20, utils.ConvertOptions{Start: 2, End: 5}, 2, 3},
+		{"end alone honoured", 20, utils.ConvertOptions{End: 5}, 0, 5},
+		{"start alone runs to the longest clip", 20, utils.ConvertOptions{Start: 3}, 3, 10},
+		{"end clamped to the duration", 8, utils.ConvertOptions{Start: 2, End: 30}, 2, 6},
+		{"end past a short video clamped", 8, utils.ConvertOptions{End: 30}, 0, 8},
+		{"longest clip stretched when sped up", 40, utils.ConvertOptions{Start: 1, Speed: 2}, 1, 20},
+		{"longest clip shortened when slowed down", 40, utils.ConvertOptions{Start: 1, Speed: 0.5}, 1, 5},
+	}
+	for _, test := range tests {
+		task := utils.ConvertTask{Options: test.options, Probe: &utils.MediaProbe{Duration: test.duration}}
+		start, length := clipRange(task, scores)
+		if start != test.start || length != test.length {
+			t.Errorf("%s: clipped %.2fs from %.2fs, want %.2fs from %.2fs", test.name, length, start, test.length, test.start)
+		}
+	}
+}
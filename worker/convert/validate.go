@@ -0,0 +1,60 @@
+package convert
+
+import (
+	"fmt"
+	"os/exec"
+
+	"github.com/deven96/whatsticker/utils"
+	"github.com/deven96/whatsticker/worker/metadata"
+	"github.com/deven96/whatsticker/worker/spec"
+	log "github.com/sirupsen/logrus"
+)
+
+// reencodeQuality is used to shrink static stickers over the size limit
+const reencodeQuality = 50
+
+// reencodeStatic shrinks a static sticker by encoding it at a lower quality
+func reencodeStatic(task utils.ConvertTask) error {
+	path := task.ConvertedPath
+	cmd := exec.Command("convert", path, "-quality", fmt.Sprint(reencodeQuality), "-define", "webp:alpha-quality=100", path)
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+	// imagemagick drops the exif chunk
+	metadata.GenerateMetadata(path, task.Options.PackName, task.Options.PackAuthor)
+	return nil
+}
+
+// validateSticker checks the converted sticker against whatsapp's
+// sticker spec, fixing what it can, and otherwise returns a
+// *spec.ViolationError with the rules still broken
+func validateSticker(task utils.ConvertTask) error {
+	report, err := spec.Validate(task.ConvertedPath)
+	if err != nil {
+		return err
+	}
+	if report.Valid() {
+		return nil
+	}
+	log.Infof("%s violates sticker spec: %s", task.ConvertedPath, report.Reason())
+	fixed := false
+	if report.Violates(spec.RuleExif) {
+		metadata.GenerateMetadata(task.ConvertedPath, task.Options.PackName, task.Options.PackAuthor)
+		fixed = true
+	}
+	if report.Violates(spec.RuleStaticSize) {
+		if err = reencodeStatic(task); err != nil {
+			return err
+		}
+		fixed = true
+	}
+	if fixed {
+		if report, err = spec.Validate(task.ConvertedPath); err != nil {
+			return err
+		}
+	}
+	if !report.Valid() {
+		return &spec.ViolationError{Report: report}
+	}
+	return nil
+}
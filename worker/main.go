@@ -31,6 +31,11 @@ func main() {
 	utils.FailOnError(err, "Failed to set QoS")
 	convertQueue := utils.GetQueue(ch, os.Getenv("CONVERT_TO_WEBP_QUEUE"), true)
 	completeQueue := utils.GetQueue(ch, os.Getenv("SEND_WEBP_TO_WHATSAPP_QUEUE"), true)
+	failedQueue := utils.GetQueue(ch, os.Getenv("FAILED_TASK_QUEUE"), true)
+	var stateQueue *amqp.Queue
+	if name := os.Getenv("TASK_STATE_QUEUE"); name != "" {
+		stateQueue = utils.GetQueue(ch, name, true)
+	}
 
 	convertQueueMsgs, err := ch.Consume(
 		convertQueue.Name, // queue
@@ -47,6 +52,10 @@ func main() {
 		// set to push to completeQueue when done
 		//set to push metrics to loggingQueue when done
 		PushTo: completeQueue,
+		// set to tell the master about tasks which could not be converted
+		PushFailuresTo: failedQueue,
+		// set to tell the master when conversion starts and ends
+		PushStatesTo: stateQueue,
 	}
 
 	go func() {
@@ -1,35 +1,100 @@
 package metadata
 
 import (
-	"fmt"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"os"
 	"os/exec"
 
 	log "github.com/sirupsen/logrus"
 )
 
-const rawFile = "worker/metadata/raw.exif"
+// DefaultPackName and DefaultPackPublisher are used for senders who have not named their pack
+const (
+	DefaultPackName      = "Whatsticker"
+	DefaultPackPublisher = "github.com/deven96"
+)
+
+// stickerPack is the json whatsapp reads sticker pack details from
+type stickerPack struct {
+	ID              string `json:"sticker-pack-id"`
+	Name            string `json:"sticker-pack-name"`
+	Publisher       string `json:"sticker-pack-publisher"`
+	AndroidStoreURL string `json:"android-app-store-link"`
+	IOSStoreURL     string `json:"ios-app-store-link"`
+}
 
 // Exif creates the exif metadata file and writes it to the image
 type Exif struct {
 	// image to impose exif file on
 	TargetImage string
+	Pack        stickerPack
+}
+
+// raw lays the pack out as a little endian tiff holding a single
+// undefined type entry (tag 0x5741) whose value is the pack json
+func (e Exif) raw() ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	// keep the & in the store links as is
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(e.Pack); err != nil {
+		return nil, err
+	}
+	body := bytes.TrimSpace(buf.Bytes())
+	header := []byte{
+		'I', 'I', 0x2a, 0x00, 0x08, 0x00, 0x00, 0x00, // byte order, magic, offset of the IFD
+		0x01, 0x00, // one entry
+		0x41, 0x57, 0x07, 0x00, // tag, type
+		0x00, 0x00, 0x00, 0x00, // count
+		0x00, 0x00, 0x00, 0x00, // offset of the value, right after the header
+		0x00, 0x00, 0x00, 0x00, // no next IFD
+	}
+	binary.LittleEndian.PutUint32(header[14:], uint32(len(body)))
+	binary.LittleEndian.PutUint32(header[18:], uint32(len(header)))
+	return append(header, body...), nil
 }
 
 // Write : writes the .exif onto the TargetImage
 func (e Exif) Write() {
-	commandString := fmt.Sprintf("webpmux -set exif %s %s -o %s", rawFile, e.TargetImage, e.TargetImage)
-	log.Debug(commandString)
-	cmd := exec.Command("bash", "-c", commandString)
-	err := cmd.Run()
+	raw, err := e.raw()
+	if err != nil {
+		log.Error("Failed to build webp metadata", err)
+		return
+	}
+	exifFile := e.TargetImage + ".exif"
+	if err = os.WriteFile(exifFile, raw, 0644); err != nil {
+		log.Error("Failed to write webp metadata", err)
+		return
+	}
+	defer os.Remove(exifFile)
+	cmd := exec.Command("webpmux", "-set", "exif", exifFile, e.TargetImage, "-o", e.TargetImage)
+	log.Debug(cmd.String())
+	err = cmd.Run()
 	if err != nil {
 		log.Error("Failed to set webp metadata", err)
 	}
 }
 
-// GenerateMetadata : Takes ConvertedPath, generates a TargetFile exif and appends that exif metadata to ConvertedPath
-func GenerateMetadata(ConvertedPath string) {
+// GenerateMetadata : Takes ConvertedPath, generates a TargetFile exif naming the sticker pack
+// and appends that exif metadata to ConvertedPath. Empty names fall back to the defaults
+func GenerateMetadata(ConvertedPath string, packName string, packPublisher string) {
+	if packName == "" {
+		packName = DefaultPackName
+	}
+	if packPublisher == "" {
+		packPublisher = DefaultPackPublisher
+	}
 	converter := Exif{
 		TargetImage: ConvertedPath,
+		Pack: stickerPack{
+			ID:              "com.nut.id.sticker.stickercontentprovider 10002",
+			Name:            packName,
+			Publisher:       packPublisher,
+			AndroidStoreURL: "https://play.google.com/store/apps/details?id=com.nut.id.sticker&referrer=user_custom",
+			IOSStoreURL:     "https://apps.apple.com/app/id1594505047",
+		},
 	}
 	converter.Write()
 }
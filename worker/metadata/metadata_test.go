@@ -0,0 +1,53 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+)
+
+// parseExif reads back the pack json a tiff made by Exif.raw points at
+func parseExif(t *testing.T, raw []byte) stickerPack {
+	t.Helper()
+	if string(raw[:4]) != "II*\x00" {
+		t.Fatalf("bad tiff header %q", raw[:4])
+	}
+	ifd := binary.LittleEndian.Uint32(raw[4:])
+	if entries := binary.LittleEndian.Uint16(raw[ifd:]); entries != 1 {
+		t.Fatalf("expected 1 entry, got %d", entries)
+	}
+	entry := raw[ifd+2:]
+	if tag := binary.LittleEndian.Uint16(entry); tag != 0x5741 {
+		t.Fatalf("expected tag 0x5741, got %#x", tag)
+	}
+	if kind := binary.LittleEndian.Uint16(entry[2:]); kind != 7 {
+		t.Fatalf("expected undefined type 7, got %d", kind)
+	}
+	count := binary.LittleEndian.Uint32(entry[4:])
+	offset := binary.LittleEndian.Uint32(entry[8:])
+	if int(offset+count) != len(raw) {
+		t.Fatalf("value at %d+%d does not end the %d byte blob", offset, count, len(raw))
+	}
+	var pack stickerPack
+	if err := json.Unmarshal(raw[offset:offset+count], &pack); err != nil {
+		t.Fatalf("value at %d is not json: %s %q", offset, err, raw[offset:offset+count])
+	}
+	return pack
+}
+
+func TestRawRoundTrips(t *testing.T) {
+	tests := []stickerPack{
+		{ID: "id", Name: DefaultPackName, Publisher: DefaultPackPublisher},
+		{Name: "Café \"quoted\"", Publisher: "me & you", AndroidStoreURL: "https://example.com/?a=1&b=2"},
+		{},
+	}
+	for _, pack := range tests {
+		raw, err := Exif{Pack: pack}.raw()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := parseExif(t, raw); got != pack {
+			t.Errorf("got %+v, want %+v", got, pack)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package spec
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/deven96/whatsticker/utils"
+)
+
+// limits whatsapp places on stickers, see utils for the size limits
+// https://faq.whatsapp.com/general/how-to-create-stickers-for-whatsapp
+const (
+	StickerSize        = 512
+	MinFrameDurationMs = 8
+	MaxDurationMs      = utils.MaxClipSeconds * 1000
+)
+
+// Rules a sticker can violate
+const (
+	RuleDimensions    = "dimensions"
+	RuleStaticSize    = "static_size"
+	RuleAnimatedSize  = "animated_size"
+	RuleFrameDuration = "frame_duration"
+	RuleDuration      = "duration"
+	RuleExif          = "exif"
+)
+
+// Violation is a single way a sticker breaks the spec
+type Violation struct {
+	Rule    string
+	Message string
+}
+
+// Report describes a webp and how it measures up against the spec
+type Report struct {
+	Width      int
+	Height     int
+	Size       int
+	Animated   bool
+	Frames     int
+	DurationMs int
+	HasExif    bool
+	Violations []Violation
+}
+
+// Valid : the sticker can be uploaded as is
+func (r Report) Valid() bool {
+	return len(r.Violations) == 0
+}
+
+// Violates : reports whether rule is among the violations
+func (r Report) Violates(rule string) bool {
+	for _, violation := range r.Violations {
+		if violation.Rule == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// Rules lists the rules violated
+func (r Report) Rules() []string {
+	rules := make([]string, len(r.Violations))
+	for i, violation := range r.Violations {
+		rules[i] = violation.Rule
+	}
+	return rules
+}
+
+// ViolationError : a sticker that could not be made to meet the spec
+type ViolationError struct {
+	Report Report
+}
+
+func (e *ViolationError) Error() string {
+	return e.Report.Reason()
+}
+
+// Reason joins the violations into a message fit for the sender
+func (r Report) Reason() string {
+	messages := make([]string, len(r.Violations))
+	for i, violation := range r.Violations {
+		messages[i] = violation.Message
+	}
+	return strings.Join(messages, ", ")
+}
+
+// ErrNotWebP is returned for files which are not a RIFF WebP container
+var ErrNotWebP = errors.New("not a webp file")
+
+func uint24(b []byte) int {
+	return int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+}
+
+// parse walks the chunks of a webp container filling in the report
+func parse(data []byte, report *Report) error {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return ErrNotWebP
+	}
+	for offset := 12; offset+8 <= len(data); {
+		fourCC := string(data[offset : offset+4])
+		size := int(binary.LittleEndian.Uint32(data[offset+4 : offset+8]))
+		start := offset + 8
+		end := start + size
+		if end > len(data) {
+			return fmt.Errorf("%s chunk overruns the file", fourCC)
+		}
+		chunk := data[start:end]
+		switch fourCC {
+		case "VP8X":
+			if len(chunk) < 10 {
+				return errors.New("VP8X chunk too short")
+			}
+			report.Animated = chunk[0]&0x02 != 0
+			report.Width = uint24(chunk[4:7]) + 1
+			report.Height = uint24(chunk[7:10]) + 1
+		case "VP8 ":
+			// a keyframe starts with a 3 byte tag then the 9d 01 2a start code
+			if report.Width == 0 && len(chunk) >= 10 {
+				report.Width = int(binary.LittleEndian.Uint16(chunk[6:8]) & 0x3fff)
+				report.Height = int(binary.LittleEndian.Uint16(chunk[8:10]) & 0x3fff)
+			}
+			report.Frames++
+		case "VP8L":
+			if report.Width == 0 && len(chunk) >= 5 {
+				bits := binary.LittleEndian.Uint32(chunk[1:5])
+				report.Width = int(bits&0x3fff) + 1
+				report.Height = int((bits>>14)&0x3fff) + 1
+			}
+			report.Frames++
+		case "ANMF":
+			if len(chunk) < 16 {
+				return errors.New("ANMF chunk too short")
+			}
+			duration := uint24(chunk[12:15])
+			if duration < MinFrameDurationMs {
+				report.Violations = append(report.Violations, Violation{
+					Rule:    RuleFrameDuration,
+					Message: fmt.Sprintf("frame %d shows for %dms, under %dms", report.Frames+1, duration, MinFrameDurationMs),
+				})
+			}
+			report.DurationMs += duration
+			report.Frames++
+		case "EXIF":
+			report.HasExif = true
+		}
+		// chunks are padded to an even size
+		offset = end + size%2
+	}
+	return nil
+}
+
+// Validate parses the webp at path and checks it against the sticker spec
+func Validate(path string) (Report, error) {
+	var report Report
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return report, err
+	}
+	report.Size = len(data)
+	if err = parse(data, &report); err != nil {
+		return report, err
+	}
+	if report.Width != StickerSize || report.Height != StickerSize {
+		report.Violations = append(report.Violations, Violation{
+			Rule:    RuleDimensions,
+			Message: fmt.Sprintf("sticker is %dx%d instead of %dx%d", report.Width, report.Height, StickerSize, StickerSize),
+		})
+	}
+	if report.Animated {
+		if report.Size > utils.MaxAnimatedBytes {
+			report.Violations = append(report.Violations, Violation{
+				Rule:    RuleAnimatedSize,
+				Message: fmt.Sprintf("animated sticker is %dKB, over %dKB", report.Size/1024, utils.MaxAnimatedBytes/1024),
+			})
+		}
+		if report.DurationMs > MaxDurationMs {
+			report.Violations = append(report.Violations, Violation{
+				Rule:    RuleDuration,
+				Message: fmt.Sprintf("animated sticker runs %.1fs, over %ds", float64(report.DurationMs)/1000, MaxDurationMs/1000),
+			})
+		}
+	} else if report.Size > utils.MaxStaticBytes {
+		report.Violations = append(report.Violations, Violation{
+			Rule:    RuleStaticSize,
+			Message: fmt.Sprintf("sticker is %dKB, over %dKB", report.Size/1024, utils.MaxStaticBytes/1024),
+		})
+	}
+	if !report.HasExif {
+		report.Violations = append(report.Violations, Violation{
+			Rule:    RuleExif,
+			Message: "sticker is missing its metadata",
+		})
+	}
+	return report, nil
+}
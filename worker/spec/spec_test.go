@@ -0,0 +1,169 @@
+package spec
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/deven96/whatsticker/utils"
+)
+
+// chunk builds a riff chunk, padded to an even size
+func chunk(fourCC string, payload []byte) []byte {
+	out := append([]byte(fourCC), 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(payload)))
+	out = append(out, payload...)
+	if len(payload)%2 == 1 {
+		out = append(out, 0)
+	}
+	return out
+}
+
+func webp(chunks ...[]byte) []byte {
+	var body []byte
+	for _, c := range chunks {
+		body = append(body, c...)
+	}
+	out := append([]byte("RIFF"), 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(out[4:], uint32(4+len(body)))
+	out = append(out, "WEBP"...)
+	return append(out, body...)
+}
+
+func put24(b []byte, v int) {
+	b[0], b[1], b[2] = byte(v), byte(v>>8), byte(v>>16)
+}
+
+func vp8x(animated bool, width, height int) []byte {
+	payload := make([]byte, 10)
+	if animated {
+		payload[0] |= 0x02
+	}
+	put24(payload[4:], width-1)
+	put24(payload[7:], height-1)
+	return chunk("VP8X", payload)
+}
+
+func vp8l(width, height int) []byte {
+	payload := make([]byte, 5)
+	payload[0] = 0x2f
+	binary.LittleEndian.PutUint32(payload[1:], uint32(width-1)|uint32(height-1)<<14)
+	return chunk("VP8L", payload)
+}
+
+func vp8(width, height int) []byte {
+	payload := []byte{0, 0, 0, 0x9d, 0x01, 0x2a, 0, 0, 0, 0}
+	binary.LittleEndian.PutUint16(payload[6:], uint16(width))
+	binary.LittleEndian.PutUint16(payload[8:], uint16(height))
+	return chunk("VP8 ", payload)
+}
+
+func anmf(durationMs int) []byte {
+	payload := make([]byte, 16)
+	put24(payload[12:], durationMs)
+	return chunk("ANMF", payload)
+}
+
+var exif = chunk("EXIF", []byte("II*\x00"))
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       []byte
+		padTo      int
+		animated   bool
+		frames     int
+		durationMs int
+		violations []string
+	}{
+		{name: "lossy static", data: webp(vp8(512, 512), exif), frames: 1},
+		{name: "lossless static", data: webp(vp8l(512, 512), exif), frames: 1},
+		{name: "extended static", data: webp(vp8x(false, 512, 512), vp8l(512, 512), exif), frames: 1},
+		{
+			name:       "wrong size without exif",
+			data:       webp(vp8l(300, 512)),
+			frames:     1,
+			violations: []string{RuleDimensions, RuleExif},
+		},
+		{
+			name:       "static too large",
+			data:       webp(vp8(512, 512), exif),
+			padTo:      utils.MaxStaticBytes + 1,
+			frames:     1,
+			violations: []string{RuleStaticSize},
+		},
+		{
+			name:       "animated",
+			data:       webp(vp8x(true, 512, 512), anmf(100), anmf(100), exif),
+			animated:   true,
+			frames:     2,
+			durationMs: 200,
+		},
+		{
+			name:       "animated with a short frame",
+			data:       webp(vp8x(true, 512, 512), anmf(100), anmf(MinFrameDurationMs-1), exif),
+			animated:   true,
+			frames:     2,
+			durationMs: 100 + MinFrameDurationMs - 1,
+			violations: []string{RuleFrameDuration},
+		},
+		{
+			name:       "animated too long and too large",
+			data:       webp(vp8x(true, 512, 512), anmf(MaxDurationMs), anmf(1000), exif),
+			padTo:      utils.MaxAnimatedBytes + 1,
+			animated:   true,
+			frames:     2,
+			durationMs: MaxDurationMs + 1000,
+			violations: []string{RuleDuration, RuleAnimatedSize},
+		},
+	}
+	dir := t.TempDir()
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data := test.data
+			if test.padTo > len(data) {
+				// unknown chunks are skipped, so padding only changes the size
+				data = webp(data[12:], chunk("JUNK", make([]byte, test.padTo-len(data)-8)))
+			}
+			path := filepath.Join(dir, "sticker.webp")
+			if err := os.WriteFile(path, data, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			report, err := Validate(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Animated != test.animated || report.Frames != test.frames || report.DurationMs != test.durationMs {
+				t.Errorf("got animated %t, %d frames over %dms", report.Animated, report.Frames, report.DurationMs)
+			}
+			if len(report.Violations) != len(test.violations) {
+				t.Fatalf("got violations %+v, want %v", report.Violations, test.violations)
+			}
+			for _, rule := range test.violations {
+				if !report.Violates(rule) {
+					t.Errorf("missing %s violation in %+v", rule, report.Violations)
+				}
+			}
+			if report.Valid() != (len(test.violations) == 0) {
+				t.Errorf("Valid() = %t with violations %+v", report.Valid(), report.Violations)
+			}
+		})
+	}
+}
+
+func TestParseRejectsBadContainers(t *testing.T) {
+	tests := map[string][]byte{
+		"empty":           {},
+		"not riff":        []byte("PNG\x00\x00\x00\x00\x00WEBP"),
+		"overrun":         webp(vp8l(512, 512))[:20],
+		"short vp8x":      webp(chunk("VP8X", make([]byte, 4))),
+		"short animation": webp(vp8x(true, 512, 512), chunk("ANMF", make([]byte, 8))),
+	}
+	for name, data := range tests {
+		var report Report
+		if err := parse(data, &report); err == nil {
+			t.Errorf("%s: parsed without error", name)
+		}
+	}
+}